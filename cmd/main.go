@@ -20,6 +20,12 @@ func run(args []string) int {
 		return 1
 	}
 
+	// env file values are flag defaults, e.g. for -token, so apply them before parsing
+	if err := internal.LoadEnvFile(); err != nil {
+		printError(err.Error())
+		return 1
+	}
+
 	cmd := args[1]
 	cmdArgs := args[2:]
 
@@ -27,10 +33,36 @@ func run(args []string) int {
 	case "help", "-h", "--help":
 		printHelp()
 		return 0
+	case "version":
+		return runVersion(cmdArgs)
 	case "jps":
 		return runJps(cmdArgs)
 	case "jattach":
 		return runJattach(cmdArgs)
+	case "bridge":
+		return runBridge(cmdArgs)
+	case "gc":
+		return runGc(cmdArgs)
+	case "exec":
+		return runExec(cmdArgs)
+	case "scan":
+		return runScan(cmdArgs)
+	case "prop":
+		return runProp(cmdArgs)
+	case "javahome":
+		return runJavaHome(cmdArgs)
+	case "flags":
+		return runFlags(cmdArgs)
+	case "profile":
+		return runProfile(cmdArgs)
+	case "listener":
+		return runListener(cmdArgs)
+	case "autoattach":
+		return runAutoattach(cmdArgs)
+	case "vmstat":
+		return runVmstat(cmdArgs)
+	case "cleanup":
+		return runCleanup(cmdArgs)
 	default:
 		printError(fmt.Sprintf("unknown command: %s", cmd))
 		printHelp()
@@ -38,6 +70,16 @@ func run(args []string) int {
 	}
 }
 
+// runVersion handles the "version" command.
+func runVersion(args []string) int {
+	opt, err := internal.ParseVersionFlags(args)
+	if err != nil {
+		printError(fmt.Sprintf("failed to parse flags: %v", err))
+		return 1
+	}
+	return internal.PrintVersion(opt)
+}
+
 // runJps handles the "jps" command.
 func runJps(args []string) int {
 	opt, err := internal.ParseJpsFlags(args)
@@ -58,34 +100,327 @@ func runJattach(args []string) int {
 	return internal.Jattach(opt)
 }
 
+// runBridge handles the "bridge" command.
+func runBridge(args []string) int {
+	opt, err := internal.ParseBridgeFlags(args)
+	if err != nil {
+		printError(fmt.Sprintf("failed to parse flags: %v", err))
+		return 1
+	}
+	return internal.Bridge(opt)
+}
+
+// runGc handles the "gc" command.
+func runGc(args []string) int {
+	opt, err := internal.ParseGcFlags(args)
+	if err != nil {
+		printError(fmt.Sprintf("failed to parse flags: %v", err))
+		return 1
+	}
+	return internal.Gc(opt)
+}
+
+// runExec handles the "exec" command.
+func runExec(args []string) int {
+	opt, err := internal.ParseExecFlags(args)
+	if err != nil {
+		printError(fmt.Sprintf("failed to parse flags: %v", err))
+		return 1
+	}
+	return internal.Exec(opt)
+}
+
+// runScan handles the "scan" command.
+func runScan(args []string) int {
+	opt, err := internal.ParseScanFlags(args)
+	if err != nil {
+		printError(fmt.Sprintf("failed to parse flags: %v", err))
+		return 1
+	}
+	return internal.Scan(opt)
+}
+
+// runProp handles the "prop" command.
+func runProp(args []string) int {
+	opt, err := internal.ParsePropFlags(args)
+	if err != nil {
+		printError(fmt.Sprintf("failed to parse flags: %v", err))
+		return 1
+	}
+	return internal.Prop(opt)
+}
+
+// runJavaHome handles the "javahome" command.
+func runJavaHome(args []string) int {
+	opt, err := internal.ParseJavaHomeFlags(args)
+	if err != nil {
+		printError(fmt.Sprintf("failed to parse flags: %v", err))
+		return 1
+	}
+	return internal.Prop(opt)
+}
+
+// runFlags handles the "flags" command.
+func runFlags(args []string) int {
+	opt, err := internal.ParseFlagsFlags(args)
+	if err != nil {
+		printError(fmt.Sprintf("failed to parse flags: %v", err))
+		return 1
+	}
+	return internal.Flags(opt)
+}
+
+// runProfile handles the "profile" command.
+func runProfile(args []string) int {
+	opt, err := internal.ParseProfileFlags(args)
+	if err != nil {
+		printError(fmt.Sprintf("failed to parse flags: %v", err))
+		return 1
+	}
+	return internal.Profile(opt)
+}
+
+// runListener handles the "listener" command.
+func runListener(args []string) int {
+	opt, err := internal.ParseListenerFlags(args)
+	if err != nil {
+		printError(fmt.Sprintf("failed to parse flags: %v", err))
+		return 1
+	}
+	return internal.Listener(opt)
+}
+
+// runAutoattach handles the "autoattach" command.
+func runAutoattach(args []string) int {
+	opt, err := internal.ParseAutoattachFlags(args)
+	if err != nil {
+		printError(fmt.Sprintf("failed to parse flags: %v", err))
+		return 1
+	}
+	return internal.Autoattach(opt)
+}
+
+// runVmstat handles the "vmstat" command.
+func runVmstat(args []string) int {
+	opt, err := internal.ParseVmstatFlags(args)
+	if err != nil {
+		printError(fmt.Sprintf("failed to parse flags: %v", err))
+		return 1
+	}
+	return internal.Vmstat(opt)
+}
+
+// runCleanup handles the "cleanup" command.
+func runCleanup(args []string) int {
+	opt, err := internal.ParseCleanupFlags(args)
+	if err != nil {
+		printError(fmt.Sprintf("failed to parse flags: %v", err))
+		return 1
+	}
+	return internal.Cleanup(opt)
+}
+
 // printHelp prints the usage information for the command line tool.
 func printHelp() {
 	fmt.Print(`Usage: jvmtool <command> [options]
 
 Commands:
   help                Show this help message.
+  version             Show version and build information.
   jps                 List Java processes for the current or specified user.
   jattach             Attach a Java agent to a running Java process.
+  autoattach          Watch for new Java processes matching a regexp and attach a Java agent to each.
+  bridge              Proxy the attach protocol of a local Java process over TCP.
+  gc                  Trigger a full garbage collection in a running Java process.
+  exec                Run a diagnostic command (as jcmd does) in a running Java process.
+  listener            Check whether the attach listener of a Java process is already running, without side effects.
+  profile             Start, stop or query a native profiler (async-profiler) in a running Java process.
+  flags               Print the VM flags of a running Java process with their origin.
+  prop                Print a single system property of a running Java process.
+  javahome            Print the java.home of a running Java process, i.e. the JDK it actually runs from.
+  vmstat              Print live heap, thread, class and GC counters of a Java process every interval, without attaching.
+  cleanup             Remove .attach_pid files left behind for processes that no longer exist.
+  scan                Show pid, owner, main class, JVM version, attachability and uptime of Java processes.
+
+version options:
+  -json                   Print the version information as JSON.
 
 jps options:
   -user <username>        Specify the user to list Java processes for. If not provided, uses the current user.
+  -users <u1,u2,...>      List Java processes for each of the given users, showing the owner after the pid.
+  -strict                 With -users, fail if any user has no Java process instead of skipping it.
+  -group-by-user          With -users, print processes grouped under a "== <username> ==" header per user.
+  -cpu                    Show CPU utilization of each process, sampled over -cpu-interval.
+  -cpu-interval <dur>     Specify the CPU sampling interval. Defaults to 500ms.
+  -concurrency <n>        Specify how many Java processes are inspected at once. Defaults to the number of CPUs.
+  -sockets                Also discover Java processes by their .java_pid attach socket in the temp directory,
+                          finding JVMs run with -XX:-UsePerfData once they have been attached to.
+  -max <n>                Inspect at most n Java processes, lowest pids first, and warn if the list was truncated.
+                          Defaults to 0, unlimited.
+  -o <file>               Write the output to a file, replaced atomically once complete.
+  -redact                 Mask the values of -D system properties whose key looks secret, in all output formats.
+  -redact-keys <k1,k2>    Specify the key substrings masked by -redact. Defaults to password,secret,token,key.
+  -heap                   Show the -Xms/-Xmx/-Xss/-Xmn sizes in bytes, e.g. "xmx=4294967296".
+  -container              Show the cgroup memory limit in bytes (cgroup v1 and v2, Linux only), e.g. "container=2147483648",
+                          flagged if -Xmx exceeds it. Omitted if the process has no limit.
+  -classes                Show the number of live loaded classes read from hsperfdata, e.g. "classes=12000".
+  -warn-classes <n>       Flag Java processes with more than n live loaded classes, a hint at a class loader leak.
+                          Implies -classes.
+  -activity               Show when each JVM last updated its hsperfdata file, e.g. "updated 2s ago".
   -l                      Show the full package name or the path to the jar file.
   -v                      Show JVM arguments.
   -m                      Show main method arguments.
   -q                      Only show process id.
+  -strict-parse           Only take a main class after -cp/-classpath/--class-path or a module after -m/--module,
+                          showing "unparseable" instead of guessing, e.g. for options with a separate value.
+  -xx                     Also print each -XX flag as "<pid> <name> <value>", booleans as true/false, in a block
+                          after the processes. With -json the flags are in the xxFlags field of each process.
+  -json                   Print the Java processes as a JSON array, including VM and main arguments and memory sizes.
+  -group-by-class         Print process counts grouped by main class, sorted by count.
 
 jattach options:
   -user <username>        Specify the user to attach to. If not provided, uses the current user.
-  -pid <pid>              Specify the pid of the Java process to attach to. (required)
+  -pid <pid>              Specify the pid of the Java process to attach to. (required unless -class or -port is given)
+  -class <name>           Resolve the pid from the main class or jar of a running Java process.
+  -port <port>            Resolve the pid from the TCP port a running Java process listens on.
+  -agentpath <path>       Specify the path to the Java agent jar. (required)
+  -agentparams <params>   Specify the parameters for the Java agent. (optional)
+  -protocol <version>     Specify the attach protocol version. Defaults to 1.
+  -print-paths            Print the .java_pid socket and .attach_pid trigger file paths before attaching, also when
+                          the target is refused. With -remote the paths are resolved on the bridge host.
+  -socket-dir <dir>       Specify the directory of the .java_pid socket. Defaults to the temp directory.
+  -attach-dir <dir>       Specify the directory of the .attach_pid trigger file. Defaults to the temp directory.
+  -maxresponse <bytes>    Specify the response size limit, 0 for unlimited. Defaults to 16 MiB.
+  -poll-interval <dur>    Specify how often to look for the attach socket while the JVM starts its listener. Defaults to 100ms.
+  -signal <QUIT|none>     Specify how to ask the JVM to start its attach listener. Defaults to QUIT.
+                          "none" only creates the .attach_pid file, e.g. with -XX:+StartAttachListener.
+  -json                   Print the attach result as JSON, with key=value agent output decoded into "status".
+  -format <template>      Print the attach result with a Go template over .Pid, .AgentPath, .Success,
+                          .ResponseCode and .Message (the error, or the agent output on success).
+  -force                  Allow attaching to the jvmtool process itself or its parent, which is refused by default.
+  -quiet                  Only print errors, without progress messages; the exit code tells the result.
+                          Implied by -json and -format.
+  -remote <host:port>     Attach through a jvmtool bridge instead of the local socket. (optional)
+  -token <token>          Specify the bridge auth token. Defaults to $JVMTOOL_BRIDGE_TOKEN.
+  Set JVMTOOL_ALLOWED_AGENT_DIRS (colon-separated) to only allow agents from those directories.
+
+bridge options:
+  -user <username>        Specify the user owning the Java process. If not provided, uses the current user.
+  -pid <pid>              Specify the pid of the Java process to bridge to. (required)
+  -listen <addr>          Specify the TCP address to listen on, e.g. :7000. Without a host only the loopback
+                          interface is bound; name a host, e.g. 0.0.0.0:7000, to accept other hosts. (required)
+  -token <token>          Specify the auth token clients must present. Defaults to $JVMTOOL_BRIDGE_TOKEN.
+  Only Java agent loads are forwarded, checked against the bridge host's JVMTOOL_ALLOWED_AGENT_DIRS.
+  The connection is not encrypted, so tunnel it, e.g. over SSH, across hosts.
+
+gc options:
+  -user <username>        Specify the user owning the Java process. If not provided, uses the current user.
+  -pid <pid>              Specify the pid of the Java process to collect. (required)
+  The heap usage read from hsperfdata is reported before and after the collection, if available.
+  Forcing a GC pauses the application; avoid it on latency-sensitive production JVMs.
+
+exec options:
+  -user <username>        Specify the user owning the Java process. If not provided, uses the current user.
+  -pid <pid>              Specify the pid of the Java process. (required)
+  -cmd <command>          Specify the diagnostic command and its arguments, e.g. "Thread.print -l". (required)
+  -maxresponse <bytes>    Specify the response size limit, 0 for unlimited (e.g. for large dumps). Defaults to 16 MiB.
+  JVMTOOL_ALLOWED_AGENT_DIRS applies to the library of JVMTI.agent_load.
+
+autoattach options:
+  -user <username>        Specify the user owning the Java processes. If not provided, uses the current user.
+  -match <regexp>         Specify a regexp matched against the command line of each Java process. (required)
   -agentpath <path>       Specify the path to the Java agent jar. (required)
   -agentparams <params>   Specify the parameters for the Java agent. (optional)
+  -interval <dur>         Specify how often to look for new Java processes. Defaults to 2s.
+  -format ndjson          Print each attach as a JSON object per line with time, pid, mainClass, success and error.
+  Each pid is attached to once; a failed attach is reported and not retried. Stop with Ctrl-C.
+
+listener options:
+  -pid <pid>              Specify the pid of the Java process to check. (required)
+  -socket-dir <dir>       Specify the directory of the .java_pid socket. Defaults to the temp directory.
+  Exits 0 if the listener is present, 2 if it is absent, 3 if the process is gone and 1 on errors.
+
+profile options:
+  -user <username>        Specify the user owning the Java process. If not provided, uses the current user.
+  -pid <pid>              Specify the pid of the Java process to profile. (required)
+  -profiler <name>        Specify the profiler. Only "async" (async-profiler) is supported, the default.
+  -lib <path>             Specify the path to the profiler library, e.g. libasyncProfiler.so. (required)
+  -args <options>         Specify the comma-separated profiler options. Defaults to "start,event=cpu".
+  Sends "load <lib> true <options>"; stop with e.g. -args "stop,file=/tmp/profile.html".
+  JVMTOOL_ALLOWED_AGENT_DIRS applies to -lib as it does to jattach -agentpath.
+
+flags options:
+  -user <username>        Specify the user owning the Java process. If not provided, uses the current user.
+  -pid <pid>              Specify the pid of the Java process. (required)
+  -diff                   Only show flags whose value differs from the default.
+
+prop options:
+  -user <username>        Specify the user owning the Java process. If not provided, uses the current user.
+  -pid <pid>              Specify the pid of the Java process. (required)
+  -name <property>        Specify the system property to print, e.g. java.version. (required)
+
+javahome options:
+  -user <username>        Specify the user owning the Java process. If not provided, uses the current user.
+  -pid <pid>              Specify the pid of the Java process. (required)
+
+vmstat options:
+  -user <username>        Specify the user owning the Java process. If not provided, uses the current user.
+  -pid <pid>              Specify the pid of the Java process to sample. (required)
+  -interval <dur>         Specify the time between two samples. Defaults to 1s.
+  -count <n>              Specify the number of samples. Defaults to 0, sampling until Ctrl-C or the JVM exits.
+  -format prometheus      Print a single snapshot of the numeric counters as Prometheus text-format metrics,
+                          e.g. jvm_gc_collection_count{pid="12345",collector="G1 incremental collections"} 42.
+  Reads the hsperfdata file; heap sizes are in KB, CLASSES counts live loaded classes and
+  "+" columns show the change since the previous sample.
+
+cleanup options:
+  -dir <dir>              Specify the directory of the .attach_pid files. Defaults to the temp directory.
+  Only files owned by the current user are removed; files that cannot be removed are reported and skipped.
+
+scan options:
+  -user <username>        Specify the user to scan Java processes for. If not provided, uses the current user.
+  -all                    Scan the Java processes of every user with an hsperfdata directory.
+                          A pid found under several users is marked with "*" as ambiguous.
+  -timeout-per-process <dur>
+                          Specify the time limit for inspecting each Java process. Defaults to 2s.
+                          Processes that time out are reported as attachable "unknown".
+  -concurrency <n>        Specify how many Java processes are inspected at once. Defaults to the number of CPUs.
+  -json                   Print the scan result as a JSON array.
+
+Environment:
+  JVMTOOL_ENV_FILE        A file of KEY=value lines applied as environment variables before flags are parsed.
+                          Defaults to <user config dir>/jvmtool/env if it exists. The real environment wins.
+  JVMTOOL_BRIDGE_TOKEN    Default for -token of jattach and bridge.
+  JVMTOOL_ALLOWED_AGENT_DIRS
+                          Colon-separated directories agents and profiler libraries may be loaded from.
 
 Examples:
+  jvmtool version -json
   jvmtool jps
   jvmtool jps -user alice
   jvmtool jps -l -v -m
+  jvmtool jps -group-by-class
+  jvmtool jps -users alice,bob
   jvmtool jattach -pid 12345 -agentpath /path/to/agent.jar
   jvmtool jattach -user alice -pid 12345 -agentpath /path/to/agent.jar -agentparams "foo=bar"
+  jvmtool jattach -class com.example.App -agentpath /path/to/agent.jar
+  jvmtool jattach -port 8080 -agentpath /path/to/agent.jar
+  jvmtool jattach -pid 12345 -agentpath /path/to/agent.jar -format "{{.Pid}} success={{.Success}}"
+  jvmtool autoattach -match com.example.App -agentpath /path/to/agent.jar
+  jvmtool gc -pid 12345
+  jvmtool exec -pid 12345 -cmd "Thread.print -l"
+  jvmtool scan -all
+  jvmtool cleanup
+  jvmtool vmstat -pid 12345 -interval 1s -count 10
+  jvmtool vmstat -pid 12345 -format prometheus
+  jvmtool prop -pid 12345 -name java.version
+  jvmtool javahome -pid 12345
+  jvmtool flags -pid 12345 -diff
+  jvmtool listener -pid 12345
+  jvmtool profile -pid 12345 -lib /opt/async-profiler/lib/libasyncProfiler.so -args start,event=cpu
+  jvmtool profile -pid 12345 -lib /opt/async-profiler/lib/libasyncProfiler.so -args stop,file=/tmp/profile.html
+  jvmtool bridge -pid 12345 -listen :7000 -token secret
+  jvmtool jattach -remote host:7000 -token secret -agentpath /path/to/agent.jar
 
 `)
 }
@@ -53,3 +53,144 @@ func TestRunJattach_InvalidArgs(t *testing.T) {
 		t.Errorf("expected exit code 1 for non-existent user, got %d", code)
 	}
 }
+
+// TestRunGc_InvalidArgs tests runGc with invalid arguments.
+func TestRunGc_InvalidArgs(t *testing.T) {
+	code := runGc([]string{"-notexist"})
+	if code != 1 {
+		t.Errorf("expected exit code 1 for invalid flag, got %d", code)
+	}
+
+	code = runGc([]string{})
+	if code != 1 {
+		t.Errorf("expected exit code 1 for missing required pid, got %d", code)
+	}
+}
+
+func TestRun_Version(t *testing.T) {
+	code := run([]string{"jvmtool", "version"})
+	if code != 0 {
+		t.Errorf("expected exit code 0, got %d", code)
+	}
+}
+
+// TestRunScan_InvalidArgs tests runScan with invalid arguments.
+func TestRunScan_InvalidArgs(t *testing.T) {
+	code := runScan([]string{"-notexist"})
+	if code != 1 {
+		t.Errorf("expected exit code 1 for invalid flag, got %d", code)
+	}
+
+	code = runScan([]string{"-all", "-user", "root"})
+	if code != 1 {
+		t.Errorf("expected exit code 1 for -user with -all, got %d", code)
+	}
+}
+
+// TestRunProp_InvalidArgs tests runProp with invalid arguments.
+func TestRunProp_InvalidArgs(t *testing.T) {
+	code := runProp([]string{"-notexist"})
+	if code != 1 {
+		t.Errorf("expected exit code 1 for invalid flag, got %d", code)
+	}
+
+	code = runProp([]string{"-pid", "12345"})
+	if code != 1 {
+		t.Errorf("expected exit code 1 for missing required name, got %d", code)
+	}
+}
+
+// TestRunFlags_InvalidArgs tests runFlags with invalid arguments.
+func TestRunFlags_InvalidArgs(t *testing.T) {
+	code := runFlags([]string{"-notexist"})
+	if code != 1 {
+		t.Errorf("expected exit code 1 for invalid flag, got %d", code)
+	}
+
+	code = runFlags([]string{"-diff"})
+	if code != 1 {
+		t.Errorf("expected exit code 1 for missing required pid, got %d", code)
+	}
+}
+
+// TestRunProfile_InvalidArgs tests runProfile with invalid arguments.
+func TestRunProfile_InvalidArgs(t *testing.T) {
+	code := runProfile([]string{"-notexist"})
+	if code != 1 {
+		t.Errorf("expected exit code 1 for invalid flag, got %d", code)
+	}
+
+	code = runProfile([]string{"-pid", "12345"})
+	if code != 1 {
+		t.Errorf("expected exit code 1 for missing required lib, got %d", code)
+	}
+}
+
+// TestRun_EnvFileError tests that an unreadable JVMTOOL_ENV_FILE fails every command.
+func TestRun_EnvFileError(t *testing.T) {
+	t.Setenv("JVMTOOL_ENV_FILE", t.TempDir()+"/missing")
+	code := run([]string{"jvmtool", "version"})
+	if code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+}
+
+// TestRunListener_InvalidArgs tests runListener with invalid arguments.
+func TestRunListener_InvalidArgs(t *testing.T) {
+	code := runListener([]string{"-notexist"})
+	if code != 1 {
+		t.Errorf("expected exit code 1 for invalid flag, got %d", code)
+	}
+
+	code = runListener([]string{})
+	if code != 1 {
+		t.Errorf("expected exit code 1 for missing required pid, got %d", code)
+	}
+}
+
+// TestRunAutoattach_InvalidArgs tests runAutoattach with invalid arguments.
+func TestRunAutoattach_InvalidArgs(t *testing.T) {
+	code := runAutoattach([]string{"-notexist"})
+	if code != 1 {
+		t.Errorf("expected exit code 1 for invalid flag, got %d", code)
+	}
+
+	code = runAutoattach([]string{"-match", "App"})
+	if code != 1 {
+		t.Errorf("expected exit code 1 for missing required agentpath, got %d", code)
+	}
+}
+
+// TestRunVmstat_InvalidArgs tests runVmstat with invalid arguments.
+func TestRunVmstat_InvalidArgs(t *testing.T) {
+	code := runVmstat([]string{"-notexist"})
+	if code != 1 {
+		t.Errorf("expected exit code 1 for invalid flag, got %d", code)
+	}
+
+	code = runVmstat([]string{})
+	if code != 1 {
+		t.Errorf("expected exit code 1 for missing required pid, got %d", code)
+	}
+}
+
+// TestRunCleanup_InvalidArgs tests runCleanup with invalid arguments.
+func TestRunCleanup_InvalidArgs(t *testing.T) {
+	code := runCleanup([]string{"-notexist"})
+	if code != 1 {
+		t.Errorf("expected exit code 1 for invalid flag, got %d", code)
+	}
+}
+
+// TestRunJavaHome_InvalidArgs tests runJavaHome with invalid arguments.
+func TestRunJavaHome_InvalidArgs(t *testing.T) {
+	code := runJavaHome([]string{"-notexist"})
+	if code != 1 {
+		t.Errorf("expected exit code 1 for invalid flag, got %d", code)
+	}
+
+	code = runJavaHome([]string{})
+	if code != 1 {
+		t.Errorf("expected exit code 1 for missing required pid, got %d", code)
+	}
+}
@@ -5,7 +5,6 @@ go 1.24
 require (
 	github.com/shirou/gopsutil v2.21.11+incompatible
 	github.com/stretchr/testify v1.10.0
-	golang.org/x/sys v0.33.0
 )
 
 require (
@@ -15,5 +14,6 @@ require (
 	github.com/tklauser/go-sysconf v0.3.15 // indirect
 	github.com/tklauser/numcpus v0.10.0 // indirect
 	github.com/yusufpapurcu/wmi v1.2.4 // indirect
+	golang.org/x/sys v0.33.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,195 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// defaultAutoattachInterval is how often autoattach looks for new JVMs.
+const defaultAutoattachInterval = 2 * time.Second
+
+// formatNdjson prints one JSON object per line, so that events can be consumed as they happen.
+const formatNdjson = "ndjson"
+
+type AutoattachOption struct {
+	User        string
+	Match       string        // regexp matched against the command line
+	AgentPath   string        // path to the Java agent jar
+	AgentParams string        // parameters for the Java agent
+	Interval    time.Duration // -interval
+	Format      string        // -format, "" for text or ndjson
+	Out         io.Writer     // results, os.Stdout if nil
+	ErrOut      io.Writer     // errors, os.Stderr if nil
+}
+
+// autoattachEvent is the ndjson record of one attach.
+type autoattachEvent struct {
+	Time      time.Time `json:"time"`
+	Pid       int32     `json:"pid"`
+	MainClass string    `json:"mainClass"`
+	Success   bool      `json:"success"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// ParseAutoattachFlags parses flags for the "autoattach" command and returns the corresponding AutoattachOption.
+func ParseAutoattachFlags(args []string) (AutoattachOption, error) {
+	autoattachFlagSet := flag.NewFlagSet("autoattach", flag.ContinueOnError)
+	user := autoattachFlagSet.String("user", "", "specify the user owning the Java processes")
+	match := autoattachFlagSet.String("match", "", "specify a regexp matched against the command line of new Java processes")
+	agentPath := autoattachFlagSet.String("agentpath", "", "specify the path to the Java agent jar")
+	agentParams := autoattachFlagSet.String("agentparams", "", "specify the parameters for the Java agent")
+	interval := autoattachFlagSet.Duration("interval", defaultAutoattachInterval, "specify how often to look for new Java processes")
+	format := autoattachFlagSet.String("format", "", "print each attach as a JSON object per line with ndjson")
+	if err := autoattachFlagSet.Parse(args); err != nil {
+		return AutoattachOption{}, err
+	}
+	return AutoattachOption{
+		User:        *user,
+		Match:       *match,
+		AgentPath:   *agentPath,
+		AgentParams: *agentParams,
+		Interval:    *interval,
+		Format:      *format,
+	}, nil
+}
+
+// AutoattachValidate validates the AutoattachOption fields, compiles Match and makes AgentPath
+// absolute, as every JVM would resolve a relative path against its own working directory.
+func (opt *AutoattachOption) AutoattachValidate() (*regexp.Regexp, error) {
+	if opt.AgentPath == "" {
+		return nil, ErrAgentPathRequired
+	}
+	if strings.ContainsRune(opt.AgentPath+opt.AgentParams, 0) {
+		return nil, errors.New("agentpath and agentparams must not contain NUL bytes")
+	}
+	if opt.Match == "" {
+		return nil, errors.New("match is required")
+	}
+	re, err := regexp.Compile(opt.Match)
+	if err != nil {
+		return nil, fmt.Errorf("invalid match: %v", err)
+	}
+	if opt.Interval <= 0 {
+		return nil, errors.New("interval must be positive")
+	}
+	if opt.Format != "" && opt.Format != formatNdjson {
+		return nil, fmt.Errorf("unsupported format %q, only %q is supported", opt.Format, formatNdjson)
+	}
+	agentPath, err := filepath.Abs(opt.AgentPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve agent path: %v", err)
+	}
+	opt.AgentPath = agentPath
+	if err := checkAgentDir(opt.AgentPath); err != nil {
+		return nil, err
+	}
+	username, err := resolveUser(opt.User)
+	if err != nil {
+		return nil, err
+	}
+	opt.User = username
+	return re, nil
+}
+
+// autoattachValidate applies the checks of jattach to one JVM before it is attached to, as the
+// agent directory and the processes may change while autoattach runs. It is a variable so that
+// tests can replace it.
+var autoattachValidate = func(username string, pid int32, agentPath string) error {
+	if err := checkAgentDir(agentPath); err != nil {
+		return err
+	}
+	_, err := validateAttachTarget(username, fmt.Sprint(pid), false)
+	return err
+}
+
+// autoattachAgent attaches the agent to one JVM. It is a variable so that tests can replace it.
+var autoattachAgent = func(pid int32, agentPath string, agentParams string) error {
+	jp := &JvmProcess{Pid: pid}
+	if err := jp.checkSocket(); err != nil {
+		return err
+	}
+	return jp.loadAgent(agentPath, agentParams)
+}
+
+// Autoattach polls the Java processes of the user and attaches the agent to every new one whose
+// command line matches, until interrupted. Each pid is attached to at most once; a failed or
+// refused attach is reported and not retried, as it would most likely fail again.
+func Autoattach(option AutoattachOption) int {
+	o := newOutput(option.Out, option.ErrOut)
+	re, err := option.AutoattachValidate()
+	if err != nil {
+		o.printError(err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if option.Format == formatNdjson {
+		defer setLogQuiet(true)()
+	} else {
+		o.print(fmt.Sprintf("watching java processes of user %s matching %q, press Ctrl-C to stop", option.User, option.Match))
+	}
+	attached := map[int32]bool{}
+	ticker := time.NewTicker(option.Interval)
+	defer ticker.Stop()
+	for {
+		autoattachPoll(option, re, attached)
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-ticker.C:
+		}
+	}
+}
+
+// autoattachPoll attaches the agent to the matching processes not in attached yet and records them.
+// Pids that are no longer listed are forgotten, so a reused pid is attached to again.
+func autoattachPoll(option AutoattachOption, re *regexp.Regexp, attached map[int32]bool) {
+	o := newOutput(option.Out, option.ErrOut)
+	pids, err := DiscoverJavaProcesses(option.User)
+	if err != nil {
+		o.printError(err)
+		return
+	}
+	live := map[int32]bool{}
+	for _, pid := range pids {
+		live[pid] = true
+	}
+	for _, p := range collectProcessInfo(pids, JpsOption{User: option.User}) {
+		if attached[p.Pid] || !re.MatchString(p.Cmd) {
+			continue
+		}
+		attached[p.Pid] = true
+		err := autoattachValidate(option.User, p.Pid, option.AgentPath)
+		if err == nil {
+			err = autoattachAgent(p.Pid, option.AgentPath, option.AgentParams)
+		}
+		if option.Format == formatNdjson {
+			event := autoattachEvent{Time: time.Now(), Pid: p.Pid, MainClass: p.mainClassOrJar, Success: err == nil}
+			if err != nil {
+				event.Error = err.Error()
+			}
+			data, _ := json.Marshal(event)
+			o.print(string(data))
+		} else if err != nil {
+			o.print(fmt.Sprintf("failed to attach to %d %s: %v", p.Pid, p.mainClassOrJar, err))
+		} else {
+			o.print(fmt.Sprintf("attached to %d %s", p.Pid, p.mainClassOrJar))
+		}
+	}
+	for pid := range attached {
+		if !live[pid] {
+			delete(attached, pid)
+		}
+	}
+}
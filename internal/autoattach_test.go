@@ -0,0 +1,193 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/XHao/jvmtool/pkg"
+)
+
+// TestAutoattachValidate tests the required flags and the agent path resolution.
+func TestAutoattachValidate(t *testing.T) {
+	opt := AutoattachOption{Match: "App", Interval: defaultAutoattachInterval}
+	if _, err := opt.AutoattachValidate(); !errors.Is(err, ErrAgentPathRequired) {
+		t.Errorf("expected ErrAgentPathRequired, got %v", err)
+	}
+
+	opt = AutoattachOption{AgentPath: "agent.jar", Interval: defaultAutoattachInterval}
+	if _, err := opt.AutoattachValidate(); err == nil || err.Error() != "match is required" {
+		t.Errorf("expected match is required, got %v", err)
+	}
+
+	opt = AutoattachOption{AgentPath: "agent.jar", Match: "(", Interval: defaultAutoattachInterval}
+	if _, err := opt.AutoattachValidate(); err == nil || !strings.HasPrefix(err.Error(), "invalid match") {
+		t.Errorf("expected invalid match, got %v", err)
+	}
+
+	opt = AutoattachOption{AgentPath: "agent.jar", Match: "App"}
+	if _, err := opt.AutoattachValidate(); err == nil || err.Error() != "interval must be positive" {
+		t.Errorf("expected interval must be positive, got %v", err)
+	}
+
+	opt = AutoattachOption{AgentPath: "agent.jar", Match: "App", Interval: defaultAutoattachInterval, Format: "json"}
+	if _, err := opt.AutoattachValidate(); err == nil || !strings.HasPrefix(err.Error(), "unsupported format") {
+		t.Errorf("expected unsupported format, got %v", err)
+	}
+
+	opt = AutoattachOption{AgentPath: "agent.jar", Match: "App", Interval: defaultAutoattachInterval}
+	if _, err := opt.AutoattachValidate(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !filepath.IsAbs(opt.AgentPath) || opt.User == "" {
+		t.Errorf("expected an absolute agent path and the current user, got %+v", opt)
+	}
+}
+
+// TestAutoattachPoll tests that only new matching processes are attached to, once per pid.
+func TestAutoattachPoll(t *testing.T) {
+	currentUser, err := user.Current()
+	if err != nil {
+		t.Fatalf("failed to get current user: %v", err)
+	}
+	t.Setenv("TMPDIR", t.TempDir())
+	for _, pid := range []int{100, 200} {
+		_, cleanup, err := prepareHsperfdataFile(currentUser.Username, pid)
+		if err != nil {
+			t.Fatalf("failed to create hsperfdata file: %v", err)
+		}
+		defer cleanup()
+	}
+
+	origPidExists, origProvider, origValidate, origAttach := pkg.PidExists, ProcessProvider, autoattachValidate, autoattachAgent
+	defer func() {
+		pkg.PidExists, ProcessProvider, autoattachValidate, autoattachAgent = origPidExists, origProvider, origValidate, origAttach
+	}()
+	live := map[int32]bool{100: true, 200: true}
+	pkg.PidExists = func(pid int32) (bool, error) { return live[pid], nil }
+	ProcessProvider = func(pid int32) ([]string, error) {
+		if pid == 100 {
+			return []string{"java", "com.example.App"}, nil
+		}
+		return []string{"java", "com.example.Other"}, nil
+	}
+	autoattachValidate = func(username string, pid int32, agentPath string) error { return nil }
+	var calls []int32
+	autoattachAgent = func(pid int32, agentPath string, agentParams string) error {
+		calls = append(calls, pid)
+		return nil
+	}
+
+	var out bytes.Buffer
+	option := AutoattachOption{User: currentUser.Username, AgentPath: "/tmp/agent.jar", Out: &out}
+	re := regexp.MustCompile(`example\.App`)
+	attached := map[int32]bool{}
+	autoattachPoll(option, re, attached)
+	autoattachPoll(option, re, attached)
+	if len(calls) != 1 || calls[0] != 100 {
+		t.Errorf("expected a single attach to 100, got %v", calls)
+	}
+	if lines := outputLines(&out); len(lines) != 1 || lines[0] != "attached to 100 com.example.App" {
+		t.Errorf("unexpected output: %v", lines)
+	}
+
+	// a pid that went away is forgotten, so it is attached to again once reused
+	live[100] = false
+	autoattachPoll(option, re, attached)
+	live[100] = true
+	out.Reset()
+	autoattachPoll(option, re, attached)
+	if len(calls) != 2 {
+		t.Errorf("expected a reused pid to be attached to again, got %v", calls)
+	}
+}
+
+// TestAutoattachPoll_Ndjson tests that each attach is printed as one JSON object per line.
+func TestAutoattachPoll_Ndjson(t *testing.T) {
+	currentUser, err := user.Current()
+	if err != nil {
+		t.Fatalf("failed to get current user: %v", err)
+	}
+	t.Setenv("TMPDIR", t.TempDir())
+	for _, pid := range []int{100, 200} {
+		_, cleanup, err := prepareHsperfdataFile(currentUser.Username, pid)
+		if err != nil {
+			t.Fatalf("failed to create hsperfdata file: %v", err)
+		}
+		defer cleanup()
+	}
+
+	origPidExists, origProvider, origValidate, origAttach := pkg.PidExists, ProcessProvider, autoattachValidate, autoattachAgent
+	defer func() {
+		pkg.PidExists, ProcessProvider, autoattachValidate, autoattachAgent = origPidExists, origProvider, origValidate, origAttach
+	}()
+	pkg.PidExists = func(pid int32) (bool, error) { return true, nil }
+	ProcessProvider = func(pid int32) ([]string, error) { return []string{"java", "com.example.App"}, nil }
+	autoattachValidate = func(username string, pid int32, agentPath string) error {
+		if pid == 200 {
+			return ErrAttachDisabled
+		}
+		return nil
+	}
+	autoattachAgent = func(pid int32, agentPath string, agentParams string) error {
+		if pid == 200 {
+			t.Errorf("expected no attach to the refused pid 200")
+		}
+		return nil
+	}
+
+	var out bytes.Buffer
+	option := AutoattachOption{User: currentUser.Username, AgentPath: "/tmp/agent.jar", Format: formatNdjson, Out: &out}
+	autoattachPoll(option, regexp.MustCompile("App"), map[int32]bool{})
+	logs := outputLines(&out)
+	if len(logs) != 2 {
+		t.Fatalf("expected one line per attach, got %v", logs)
+	}
+	var events []autoattachEvent
+	for _, line := range logs {
+		var event autoattachEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("expected a JSON object per line, got %q: %v", line, err)
+		}
+		events = append(events, event)
+	}
+	if !events[0].Success || events[0].Pid != 100 || events[0].Time.IsZero() {
+		t.Errorf("unexpected event: %+v", events[0])
+	}
+	if events[1].Success || events[1].Error != ErrAttachDisabled.Error() {
+		t.Errorf("unexpected event: %+v", events[1])
+	}
+}
+
+// TestAutoattachValidate_PerAttach tests that each attach is checked like jattach, including the agent directory.
+func TestAutoattachValidate_PerAttach(t *testing.T) {
+	currentUser, err := user.Current()
+	if err != nil {
+		t.Fatalf("failed to get current user: %v", err)
+	}
+	t.Setenv("TMPDIR", t.TempDir())
+	_, cleanup, err := prepareHsperfdataFile(currentUser.Username, os.Getpid())
+	if err != nil {
+		t.Fatalf("failed to create hsperfdata file: %v", err)
+	}
+	defer cleanup()
+
+	if err := autoattachValidate(currentUser.Username, int32(os.Getpid()), "/tmp/agent.jar"); !errors.Is(err, ErrAttachSelf) {
+		t.Errorf("expected ErrAttachSelf, got: %v", err)
+	}
+	// the allowed directories are read again on every attach
+	agentPath := filepath.Join(t.TempDir(), "agent.jar")
+	if err := os.WriteFile(agentPath, nil, 0644); err != nil {
+		t.Fatalf("failed to create agent: %v", err)
+	}
+	t.Setenv(allowedAgentDirsEnv, t.TempDir())
+	if err := autoattachValidate(currentUser.Username, int32(os.Getpid()), agentPath); !errors.Is(err, ErrAgentPathNotAllowed) {
+		t.Errorf("expected ErrAgentPathNotAllowed, got: %v", err)
+	}
+}
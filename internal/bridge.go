@@ -0,0 +1,267 @@
+package internal
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// bridgeTokenEnv is the environment variable holding the default bridge auth token.
+const bridgeTokenEnv = "JVMTOOL_BRIDGE_TOKEN"
+
+// bridgeMaxRequest caps the token line and the attach request, each.
+const bridgeMaxRequest = 64 << 10
+
+// bridgeHandshakeTimeout bounds how long a client may take to send the token and the request,
+// so that idle connections cannot hold a goroutine and a file descriptor. It is a variable so
+// that tests can shorten it.
+var bridgeHandshakeTimeout = 10 * time.Second
+
+type BridgeOption struct {
+	User   string
+	Pid    string
+	Listen string
+	Token  string
+	Out    io.Writer // results, os.Stdout if nil
+	ErrOut io.Writer // errors, os.Stderr if nil
+}
+
+// ParseBridgeFlags parses flags for the "bridge" command and returns the corresponding BridgeOption.
+func ParseBridgeFlags(args []string) (BridgeOption, error) {
+	bridgeFlagSet := flag.NewFlagSet("bridge", flag.ContinueOnError)
+	user := bridgeFlagSet.String("user", "", "specify the user owning the Java process")
+	pid := bridgeFlagSet.String("pid", "", "specify the pid of the Java process to bridge to")
+	listen := bridgeFlagSet.String("listen", "", "specify the TCP address to listen on")
+	token := bridgeFlagSet.String("token", os.Getenv(bridgeTokenEnv), "specify the auth token clients must present")
+	if err := bridgeFlagSet.Parse(args); err != nil {
+		return BridgeOption{}, err
+	}
+	return BridgeOption{
+		User:   *user,
+		Pid:    *pid,
+		Listen: *listen,
+		Token:  *token,
+	}, nil
+}
+
+// BridgeValidate validates the BridgeOption fields. A Listen address without a host, e.g. ":7000",
+// is bound to the loopback interface; other interfaces must be named explicitly.
+func (opt *BridgeOption) BridgeValidate() error {
+	if opt.Listen == "" {
+		return fmt.Errorf("listen is required")
+	}
+	host, port, err := net.SplitHostPort(opt.Listen)
+	if err != nil {
+		return fmt.Errorf("invalid listen address: %v", err)
+	}
+	if host == "" {
+		opt.Listen = net.JoinHostPort("127.0.0.1", port)
+	}
+	if opt.Token == "" {
+		return fmt.Errorf("token is required")
+	}
+	username, err := validateTarget(opt.User, opt.Pid)
+	if err != nil {
+		return err
+	}
+	opt.User = username
+	return nil
+}
+
+// Bridge accepts TCP connections and proxies the attach protocol to the local JVM's unix socket.
+// Each client must send the auth token on its first line before any protocol bytes are forwarded,
+// and only Java agent loads from the bridge host's allowed agent directories are forwarded. The
+// channel is not encrypted, so a bridge reachable from other hosts should be tunneled, e.g. over SSH.
+func Bridge(option BridgeOption) int {
+	o := newOutput(option.Out, option.ErrOut)
+	if err := option.BridgeValidate(); err != nil {
+		o.printError(err)
+		return 1
+	}
+
+	jp := &JvmProcess{
+		Pid: toInt32(option.Pid),
+	}
+	if err := jp.checkSocket(); err != nil {
+		o.printError(err)
+		return 1
+	}
+
+	l, err := net.Listen("tcp", option.Listen)
+	if err != nil {
+		o.printError(fmt.Errorf("failed to listen on %s: %v", option.Listen, err))
+		return 1
+	}
+	defer l.Close()
+	o.print(fmt.Sprintf("bridging %s to java process %d", l.Addr(), jp.Pid))
+	if !isLoopbackAddr(l.Addr()) {
+		o.warn(fmt.Sprintf("%s is not a loopback address, the token and attach requests are sent unencrypted", l.Addr()))
+	}
+
+	if err := serveBridge(l, option.Token, jp); err != nil {
+		o.printError(err)
+		return 1
+	}
+	return 0
+}
+
+// serveBridge accepts connections on l until it is closed, proxying each authenticated one to jp.
+func serveBridge(l net.Listener, token string, jp *JvmProcess) error {
+	timeout := bridgeHandshakeTimeout
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("bridge accept failed: %v", err)
+		}
+		go handleBridgeConn(conn, token, jp, timeout)
+	}
+}
+
+// handleBridgeConn authenticates a single client and proxies its load request to the JVM's attach
+// listener. The token and the request must arrive within timeout and bridgeMaxRequest. Each is
+// answered with a status line, and the JVM is dialed only once the request has been validated.
+func handleBridgeConn(conn net.Conn, token string, jp *JvmProcess, timeout time.Duration) {
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	reader := bufio.NewReaderSize(io.LimitReader(conn, 2*bridgeMaxRequest), bridgeMaxRequest)
+	line, err := reader.ReadSlice('\n')
+	if err != nil {
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(strings.TrimSuffix(string(line), "\n")), []byte(token)) != 1 {
+		log(fmt.Sprintf("bridge rejected %s: invalid token", conn.RemoteAddr()))
+		conn.Write([]byte("error: invalid token\n"))
+		return
+	}
+
+	conn.Write([]byte("ok\n"))
+
+	request, err := readBridgeRequest(reader)
+	if err != nil {
+		log(fmt.Sprintf("bridge rejected %s: %v", conn.RemoteAddr(), err))
+		conn.Write([]byte(fmt.Sprintf("error: %v\n", err)))
+		return
+	}
+	// the target is dialed only for a request that passed validation
+	target, err := jp.dial()
+	if err != nil {
+		conn.Write([]byte(fmt.Sprintf("error: failed to connect to target process %d: %v\n", jp.Pid, err)))
+		return
+	}
+	defer target.Close()
+	conn.Write([]byte("ok\n"))
+
+	if _, err := target.Write(request); err != nil {
+		return
+	}
+	// the JVM replies and closes the connection, the client sends nothing more
+	io.Copy(conn, target)
+}
+
+// readBridgeRequest reads an attach request, the protocol version, the command and
+// attachArgCount arguments, each NUL-terminated, and refuses anything but the Java agent
+// load that loadAgentResult sends.
+func readBridgeRequest(reader *bufio.Reader) ([]byte, error) {
+	var request []byte
+	var fields []string
+	for len(fields) < 2+attachArgCount {
+		field, err := reader.ReadSlice(0)
+		if err != nil {
+			return nil, errors.New("incomplete or oversized attach request")
+		}
+		request = append(request, field...)
+		if len(request) > bridgeMaxRequest {
+			return nil, errors.New("incomplete or oversized attach request")
+		}
+		fields = append(fields, string(field[:len(field)-1]))
+	}
+	if err := checkBridgeRequest(fields[1], fields[2:]); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// checkBridgeRequest accepts only "load instrument false <agent path>[=<params>]", with the
+// agent path inside the bridge host's allowed agent directories.
+func checkBridgeRequest(cmd string, args []string) error {
+	if cmd != "load" {
+		return fmt.Errorf("attach command %q is not allowed, only load", cmd)
+	}
+	if args[0] != "instrument" || args[1] != "false" {
+		return fmt.Errorf("load of %q is not allowed, only Java agents", args[0])
+	}
+	agentPath, _, _ := strings.Cut(args[2], "=")
+	if agentPath == "" {
+		return errors.New("agent path is required")
+	}
+	return checkAgentDir(agentPath)
+}
+
+// isLoopbackAddr reports whether addr is bound to a loopback interface.
+func isLoopbackAddr(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	return ok && tcpAddr.IP.IsLoopback()
+}
+
+// dialBridge returns a connectFunc that reaches a JVM through a jvmtool bridge at addr.
+func dialBridge(addr string, token string) connectFunc {
+	return func(pid int32) (net.Conn, error) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := conn.Write([]byte(token + "\n")); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		// the bridge sends nothing after the token status line until the request is written
+		reader := bufio.NewReader(conn)
+		if err := readBridgeStatus(reader, addr); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return &bridgeConn{Conn: conn, reader: reader, addr: addr}, nil
+	}
+}
+
+// readBridgeStatus reads a status line of the bridge, "ok" or "error: <reason>".
+func readBridgeStatus(reader *bufio.Reader, addr string) error {
+	status, err := reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("bridge %s closed the connection", addr)
+	}
+	if status != "ok\n" {
+		return fmt.Errorf("bridge %s: %s", addr, strings.TrimSpace(strings.TrimPrefix(status, "error: ")))
+	}
+	return nil
+}
+
+// bridgeConn is a connection to a bridge that has accepted the token. The bridge answers the
+// request with a second status line before the JVM's response, which the first Read consumes.
+type bridgeConn struct {
+	net.Conn
+	reader  *bufio.Reader
+	addr    string
+	checked bool
+}
+
+func (c *bridgeConn) Read(p []byte) (int, error) {
+	if !c.checked {
+		c.checked = true
+		if err := readBridgeStatus(c.reader, c.addr); err != nil {
+			return 0, err
+		}
+	}
+	return c.reader.Read(p)
+}
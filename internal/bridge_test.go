@@ -0,0 +1,173 @@
+package internal
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeJvmConnect returns a connectFunc whose peer reads a load request and replies with resp.
+func fakeJvmConnect(resp string) connectFunc {
+	return recordingJvmConnect(new([]byte), resp)
+}
+
+// recordingJvmConnect is fakeJvmConnect that also stores the raw request in request.
+func recordingJvmConnect(request *[]byte, resp string) connectFunc {
+	return func(pid int32) (net.Conn, error) {
+		client, server := net.Pipe()
+		go func() {
+			defer server.Close()
+			buf := make([]byte, 1)
+			for nul := 0; nul < 5; {
+				if _, err := server.Read(buf); err != nil {
+					return
+				}
+				*request = append(*request, buf[0])
+				if buf[0] == 0 {
+					nul++
+				}
+			}
+			server.Write([]byte(resp))
+		}()
+		return client, nil
+	}
+}
+
+// TestBridge_LoadAgent tests attaching through a bridge with valid and invalid tokens.
+func TestBridge_LoadAgent(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+	go serveBridge(l, "secret", &JvmProcess{Pid: 12345, connect: fakeJvmConnect("0\n0\n")})
+
+	jp := &JvmProcess{connect: dialBridge(l.Addr().String(), "secret")}
+	assert.Nil(t, jp.loadAgent("/tmp/agent.jar", ""))
+
+	jp = &JvmProcess{connect: dialBridge(l.Addr().String(), "wrong")}
+	err = jp.loadAgent("/tmp/agent.jar", "")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid token")
+}
+
+// TestBridgeValidate tests the BridgeValidate method of BridgeOption.
+func TestBridgeValidate(t *testing.T) {
+	opt := BridgeOption{Pid: "12345", Token: "secret"}
+	assert.EqualError(t, opt.BridgeValidate(), "listen is required")
+
+	opt = BridgeOption{Pid: "12345", Listen: ":7000"}
+	assert.EqualError(t, opt.BridgeValidate(), "token is required")
+}
+
+// TestBridge_Handshake tests that the bridge drops idle and oversized clients and forwards
+// nothing but Java agent loads.
+func TestBridge_Handshake(t *testing.T) {
+	origTimeout := bridgeHandshakeTimeout
+	defer func() { bridgeHandshakeTimeout = origTimeout }()
+	bridgeHandshakeTimeout = 50 * time.Millisecond
+	// the bridge logs rejections from its own goroutines
+	origLogger := globalLogger
+	defer func() { globalLogger = origLogger }()
+	var mu sync.Mutex
+	logInit(func(msg string) {
+		mu.Lock()
+		defer mu.Unlock()
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	var forwarded []byte
+	var dialed atomic.Int32
+	connect := recordingJvmConnect(&forwarded, "0\n0\n")
+	served := make(chan struct{})
+	go func() {
+		serveBridge(l, "secret", &JvmProcess{Pid: 12345, connect: func(pid int32) (net.Conn, error) {
+			dialed.Add(1)
+			return connect(pid)
+		}})
+		close(served)
+	}()
+	defer func() {
+		l.Close()
+		<-served
+	}()
+
+	// a client that never sends the token is disconnected
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	reply, _ := io.ReadAll(conn)
+	conn.Close()
+	assert.Empty(t, reply)
+
+	// an endless token line is cut off
+	conn, err = net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	conn.Write(bytes.Repeat([]byte("x"), bridgeMaxRequest+1))
+	reply, _ = io.ReadAll(conn)
+	conn.Close()
+	assert.Empty(t, reply)
+
+	// other attach commands and native libraries are refused before the JVM is dialed
+	jp := &JvmProcess{connect: dialBridge(l.Addr().String(), "secret")}
+	_, err = jp.jcmd("VM.version")
+	assert.ErrorContains(t, err, `attach command "jcmd" is not allowed`)
+	_, _, err = jp.load("/tmp/libagent.so", true, "")
+	assert.ErrorContains(t, err, "only Java agents")
+	assert.Equal(t, int32(0), dialed.Load())
+
+	assert.Nil(t, jp.loadAgent("/tmp/agent.jar", ""))
+	assert.Equal(t, "1\x00load\x00instrument\x00false\x00/tmp/agent.jar\x00", string(forwarded))
+	assert.Equal(t, int32(1), dialed.Load())
+}
+
+// TestBridge_AllowedAgentDirs tests that the bridge checks agent paths against its own allowlist.
+func TestBridge_AllowedAgentDirs(t *testing.T) {
+	agentDir := t.TempDir()
+	agentPath := filepath.Join(agentDir, "agent.jar")
+	if err := os.WriteFile(agentPath, nil, 0644); err != nil {
+		t.Fatalf("failed to create agent: %v", err)
+	}
+	t.Setenv(allowedAgentDirsEnv, t.TempDir())
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+	go serveBridge(l, "secret", &JvmProcess{Pid: 12345, connect: fakeJvmConnect("0\n0\n")})
+
+	jp := &JvmProcess{connect: dialBridge(l.Addr().String(), "secret")}
+	assert.ErrorContains(t, jp.loadAgent(agentPath+"=debug", ""), ErrAgentPathNotAllowed.Error())
+
+	t.Setenv(allowedAgentDirsEnv, agentDir)
+	assert.Nil(t, jp.loadAgent(agentPath, "debug"))
+}
+
+// TestBridgeValidate_Listen tests that a listen address without a host binds the loopback interface.
+func TestBridgeValidate_Listen(t *testing.T) {
+	opt := BridgeOption{Pid: "12345", Token: "secret", Listen: "7000"}
+	assert.ErrorContains(t, opt.BridgeValidate(), "invalid listen address")
+
+	opt = BridgeOption{Pid: "12345", Token: "secret", Listen: ":7000"}
+	opt.BridgeValidate()
+	assert.Equal(t, "127.0.0.1:7000", opt.Listen)
+
+	opt = BridgeOption{Pid: "12345", Token: "secret", Listen: "0.0.0.0:7000"}
+	opt.BridgeValidate()
+	assert.Equal(t, "0.0.0.0:7000", opt.Listen)
+}
@@ -0,0 +1,82 @@
+//go:build linux
+
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/XHao/jvmtool/pkg"
+)
+
+// cgroupV1Unlimited is the smallest cgroup v1 memory.limit_in_bytes treated as no limit;
+// the kernel reports an unset limit as a page-aligned value close to math.MaxInt64.
+const cgroupV1Unlimited = 1 << 62
+
+// containerMemoryLimit returns the cgroup memory limit of pid in bytes, or 0 if it has none or
+// it cannot be read. The cgroup filesystem is read through /proc/<pid>/root, so a containerized
+// process is resolved in its own mount namespace. Both the cgroup v2 memory.max and the cgroup v1
+// memory.limit_in_bytes are supported.
+func containerMemoryLimit(pid int32) int64 {
+	data, err := os.ReadFile(filepath.Join(pkg.ProcRoot, strconv.Itoa(int(pid)), "cgroup"))
+	if err != nil {
+		return 0
+	}
+	cgroupFS := filepath.Join(pkg.ProcRoot, strconv.Itoa(int(pid)), "root", "sys", "fs", "cgroup")
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		// hierarchy-ID:controller-list:cgroup-path
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		var dir, file string
+		if fields[0] == "0" && fields[1] == "" {
+			dir, file = cgroupFS, "memory.max"
+		} else if hasController(fields[1], "memory") {
+			dir, file = filepath.Join(cgroupFS, "memory"), "memory.limit_in_bytes"
+		} else {
+			continue
+		}
+		// the path is relative to the host's hierarchy; inside a cgroup namespace the
+		// process's own cgroup is mounted as the root instead
+		for _, path := range []string{filepath.Join(dir, fields[2], file), filepath.Join(dir, file)} {
+			if limit, ok := readMemoryLimit(path); ok {
+				return limit
+			}
+		}
+	}
+	return 0
+}
+
+// hasController reports whether the comma-separated cgroup v1 controller list contains controller.
+func hasController(controllers string, controller string) bool {
+	for _, c := range strings.Split(controllers, ",") {
+		if c == controller {
+			return true
+		}
+	}
+	return false
+}
+
+// readMemoryLimit reads a cgroup memory limit file. ok is false if the file is missing or
+// malformed; an explicit "max" or cgroup v1 unlimited value is a valid limit of 0.
+func readMemoryLimit(path string) (int64, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "max" {
+		return 0, true
+	}
+	limit, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	if limit >= cgroupV1Unlimited {
+		return 0, true
+	}
+	return limit, true
+}
@@ -0,0 +1,53 @@
+//go:build linux
+
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/XHao/jvmtool/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeProcFile writes a file relative to the fake procfs root, creating its directories.
+func writeProcFile(t *testing.T, root string, path string, content string) {
+	t.Helper()
+	full := filepath.Join(root, path)
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContainerMemoryLimit(t *testing.T) {
+	origProcRoot := pkg.ProcRoot
+	defer func() { pkg.ProcRoot = origProcRoot }()
+	procRoot := t.TempDir()
+	pkg.ProcRoot = procRoot
+
+	// cgroup v2 inside a cgroup namespace: the own cgroup is mounted as the root
+	writeProcFile(t, procRoot, "1/cgroup", "0::/\n")
+	writeProcFile(t, procRoot, "1/root/sys/fs/cgroup/memory.max", "536870912\n")
+	// cgroup v2 seen from the host
+	writeProcFile(t, procRoot, "2/cgroup", "0::/kubepods/pod1/abc\n")
+	writeProcFile(t, procRoot, "2/root/sys/fs/cgroup/kubepods/pod1/abc/memory.max", "1073741824\n")
+	// cgroup v1 with the memory controller co-mounted
+	writeProcFile(t, procRoot, "3/cgroup", "12:cpu,cpuacct:/docker/abc\n4:memory:/docker/abc\n")
+	writeProcFile(t, procRoot, "3/root/sys/fs/cgroup/memory/docker/abc/memory.limit_in_bytes", "268435456\n")
+	// no limits
+	writeProcFile(t, procRoot, "4/cgroup", "0::/user.slice\n")
+	writeProcFile(t, procRoot, "4/root/sys/fs/cgroup/user.slice/memory.max", "max\n")
+	writeProcFile(t, procRoot, "5/cgroup", "4:memory:/\n")
+	writeProcFile(t, procRoot, "5/root/sys/fs/cgroup/memory/memory.limit_in_bytes", "9223372036854771712\n")
+
+	assert.Equal(t, int64(536870912), containerMemoryLimit(1))
+	assert.Equal(t, int64(1073741824), containerMemoryLimit(2))
+	assert.Equal(t, int64(268435456), containerMemoryLimit(3))
+	assert.Equal(t, int64(0), containerMemoryLimit(4))
+	assert.Equal(t, int64(0), containerMemoryLimit(5))
+	assert.Equal(t, int64(0), containerMemoryLimit(6))
+}
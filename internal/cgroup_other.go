@@ -0,0 +1,8 @@
+//go:build !linux
+
+package internal
+
+// containerMemoryLimit returns 0, cgroups only exist on Linux.
+func containerMemoryLimit(pid int32) int64 {
+	return 0
+}
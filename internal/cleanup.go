@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/XHao/jvmtool/pkg"
+)
+
+type CleanupOption struct {
+	Dir    string    // directory of the .attach_pid trigger files
+	Out    io.Writer // results, os.Stdout if nil
+	ErrOut io.Writer // errors, os.Stderr if nil
+}
+
+// ParseCleanupFlags parses flags for the "cleanup" command and returns the corresponding CleanupOption.
+func ParseCleanupFlags(args []string) (CleanupOption, error) {
+	cleanupFlagSet := flag.NewFlagSet("cleanup", flag.ContinueOnError)
+	dir := cleanupFlagSet.String("dir", "", "specify the directory of the attach trigger files")
+	if err := cleanupFlagSet.Parse(args); err != nil {
+		return CleanupOption{}, err
+	}
+	return CleanupOption{Dir: *dir}, nil
+}
+
+// Cleanup removes the .attach_pid trigger files of processes that no longer exist, as left behind
+// by attaches that were interrupted before checkSocket removed them. Only files owned by the
+// current user are removed; files that cannot be removed are reported and skipped.
+func Cleanup(option CleanupOption) int {
+	o := newOutput(option.Out, option.ErrOut)
+	current, err := user.Current()
+	if err != nil {
+		o.printError(err)
+		return 1
+	}
+	stale, err := staleAttachFiles(orTempDir(option.Dir), current.Username)
+	if err != nil {
+		o.printError(err)
+		return 1
+	}
+	removed := 0
+	for _, file := range stale {
+		if err := os.Remove(file); err != nil {
+			o.printError(fmt.Errorf("cannot remove %s: %v", file, err))
+			continue
+		}
+		o.print("removed " + file)
+		removed++
+	}
+	o.print(fmt.Sprintf("removed %d stale files", removed))
+	return 0
+}
+
+// staleAttachFiles returns the .attach_pid files in dir owned by username whose process is gone.
+func staleAttachFiles(dir string, username string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, ".attach_pid*"))
+	if err != nil {
+		return nil, err
+	}
+	stale := []string{}
+	for _, file := range files {
+		pid, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(file), ".attach_pid"))
+		if err != nil || pid <= 0 {
+			continue
+		}
+		info, err := os.Lstat(file)
+		if err != nil || !info.Mode().IsRegular() || !fileOwnedBy(info, username) {
+			continue
+		}
+		if exist, _ := pkg.PidExists(int32(pid)); !exist {
+			stale = append(stale, file)
+		}
+	}
+	return stale, nil
+}
@@ -0,0 +1,35 @@
+//go:build unix
+
+package internal
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/XHao/jvmtool/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCleanup tests that only the .attach_pid files of gone processes are removed.
+func TestCleanup(t *testing.T) {
+	origPidExists := pkg.PidExists
+	defer func() { pkg.PidExists = origPidExists }()
+	pkg.PidExists = func(pid int32) (bool, error) { return pid == 100, nil }
+
+	dir := t.TempDir()
+	for _, name := range []string{".attach_pid100", ".attach_pid200", ".attach_pidx", ".java_pid200"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out bytes.Buffer
+	assert.Equal(t, 0, Cleanup(CleanupOption{Dir: dir, Out: &out}))
+	assert.Equal(t, []string{"removed " + filepath.Join(dir, ".attach_pid200"), "removed 1 stale files"}, outputLines(&out))
+	for _, name := range []string{".attach_pid100", ".attach_pidx", ".java_pid200"} {
+		assert.FileExists(t, filepath.Join(dir, name))
+	}
+	assert.NoFileExists(t, filepath.Join(dir, ".attach_pid200"))
+}
@@ -0,0 +1,47 @@
+//go:build darwin
+
+package internal
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/XHao/jvmtool/pkg"
+)
+
+// fallbackCmdline is used when gopsutil cannot read the command line of pid. macOS has no
+// /proc and sysctl may be restricted, so the command line is rebuilt from the hsperfdata file.
+func fallbackCmdline(pid int32) ([]string, error) {
+	// the owner is unknown here, so look in every user's hsperfdata directory
+	for _, dir := range hsperfdataDirs("*") {
+		files, _ := filepath.Glob(filepath.Join(dir, fmt.Sprint(pid)))
+		if len(files) == 0 {
+			continue
+		}
+		perfData, err := pkg.ReadPerfData(files[0])
+		if err != nil {
+			return nil, err
+		}
+		return perfDataCmdline(perfData, pid)
+	}
+	return nil, fmt.Errorf("no hsperfdata file for process %d", pid)
+}
+
+// perfDataCmdline rebuilds a command line from the java.rt.vmArgs and sun.rt.javaCommand counters.
+// Arguments are split on whitespace, so quoting within them is lost.
+func perfDataCmdline(perfData *pkg.PerfData, pid int32) ([]string, error) {
+	javaCommand, _ := perfData.String("sun.rt.javaCommand")
+	if strings.TrimSpace(javaCommand) == "" {
+		return nil, fmt.Errorf("no java command in the hsperfdata file of process %d", pid)
+	}
+	cmdSlice := []string{"java"}
+	vmArgs, _ := perfData.String("java.rt.vmArgs")
+	cmdSlice = append(cmdSlice, strings.Fields(vmArgs)...)
+	// a jar is launched as "-jar app.jar" on the command line but recorded as just "app.jar"
+	fields := strings.Fields(javaCommand)
+	if strings.HasSuffix(fields[0], ".jar") {
+		cmdSlice = append(cmdSlice, "-jar")
+	}
+	return append(cmdSlice, fields...), nil
+}
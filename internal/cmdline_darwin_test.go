@@ -0,0 +1,35 @@
+//go:build darwin
+
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/XHao/jvmtool/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPerfDataCmdline tests rebuilding jps output from the hsperfdata counters.
+func TestPerfDataCmdline(t *testing.T) {
+	perfData := &pkg.PerfData{Counters: map[string]pkg.PerfCounter{
+		"sun.rt.javaCommand": {Name: "sun.rt.javaCommand", IsString: true, String: "com.example.App arg1 arg2"},
+		"java.rt.vmArgs":     {Name: "java.rt.vmArgs", IsString: true, String: "-Xmx1g -XX:+UseG1GC"},
+	}}
+	cmdSlice, err := perfDataCmdline(perfData, 12345)
+	assert.Nil(t, err)
+	mainClass, vmArgs, mainArgs := analyzeVmCmd(cmdSlice, JpsOption{ShowVMArgs: true, ShowArgs: true})
+	assert.Equal(t, "com.example.App", mainClass)
+	assert.Equal(t, "-Xmx1g -XX:+UseG1GC", strings.TrimSpace(vmArgs))
+	assert.Equal(t, "arg1 arg2", mainArgs)
+
+	perfData.Counters["sun.rt.javaCommand"] = pkg.PerfCounter{IsString: true, String: "/opt/app.jar --port 8080"}
+	cmdSlice, err = perfDataCmdline(perfData, 12345)
+	assert.Nil(t, err)
+	mainClass, _, mainArgs = analyzeVmCmd(cmdSlice, JpsOption{ShowArgs: true})
+	assert.Equal(t, "/opt/app.jar", mainClass)
+	assert.Equal(t, "--port 8080", mainArgs)
+
+	_, err = perfDataCmdline(&pkg.PerfData{}, 12345)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,28 @@
+//go:build linux
+
+package internal
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// fallbackCmdline is used when gopsutil cannot read the command line of pid.
+func fallbackCmdline(pid int32) ([]string, error) {
+	return readProcCmdline(pid)
+}
+
+// readProcCmdline reads the command line of pid directly from /proc/<pid>/cmdline,
+// which stays readable by the owner on kernels where gopsutil fails.
+func readProcCmdline(pid int32) ([]string, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return nil, err
+	}
+	cmdline := strings.TrimRight(string(data), "\x00")
+	if cmdline == "" {
+		return nil, fmt.Errorf("empty command line for process %d", pid)
+	}
+	return strings.Split(cmdline, "\x00"), nil
+}
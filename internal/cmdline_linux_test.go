@@ -0,0 +1,24 @@
+//go:build linux
+
+package internal
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestReadProcCmdline tests reading the current process command line from /proc.
+func TestReadProcCmdline(t *testing.T) {
+	cmdSlice, err := readProcCmdline(int32(os.Getpid()))
+	if err != nil {
+		t.Fatalf("readProcCmdline failed: %v", err)
+	}
+	if strings.Join(cmdSlice, " ") != strings.Join(os.Args, " ") {
+		t.Errorf("expected %v, got %v", os.Args, cmdSlice)
+	}
+
+	if _, err := readProcCmdline(999999); err == nil {
+		t.Errorf("expected error for non-existent pid")
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package internal
+
+import "errors"
+
+// fallbackCmdline is used when gopsutil cannot read the command line of pid.
+// This platform has no fallback.
+func fallbackCmdline(pid int32) ([]string, error) {
+	return nil, errors.New("no fallback for reading the command line on this platform")
+}
@@ -0,0 +1,27 @@
+//go:build linux
+
+package internal
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+)
+
+// geteuid returns the effective uid of jvmtool. It is a variable so that tests can replace it.
+var geteuid = os.Geteuid
+
+// checkCrossUserAttach fails early if username is not the effective user of jvmtool and jvmtool
+// is not root. The attach listener only accepts peers with the JVM's effective uid or uid 0,
+// so a capability such as CAP_SETUID is not enough, jvmtool does not switch its uid.
+func checkCrossUserAttach(username string) error {
+	u, err := user.Lookup(username)
+	if err != nil {
+		return nil
+	}
+	euid := geteuid()
+	if euid == 0 || u.Uid == strconv.Itoa(euid) {
+		return nil
+	}
+	return ErrCrossUserAttach
+}
@@ -0,0 +1,30 @@
+//go:build linux
+
+package internal
+
+import (
+	"os/user"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckCrossUserAttach(t *testing.T) {
+	current, err := user.Current()
+	if err != nil {
+		t.Fatalf("failed to get current user: %v", err)
+	}
+	uid, _ := strconv.Atoi(current.Uid)
+	origGeteuid := geteuid
+	defer func() { geteuid = origGeteuid }()
+
+	geteuid = func() int { return uid }
+	assert.Nil(t, checkCrossUserAttach(current.Username))
+
+	geteuid = func() int { return uid + 1 }
+	assert.ErrorIs(t, checkCrossUserAttach(current.Username), ErrCrossUserAttach)
+
+	geteuid = func() int { return 0 }
+	assert.Nil(t, checkCrossUserAttach(current.Username))
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package internal
+
+// checkCrossUserAttach does nothing, the effective uid is only checked early on Linux.
+func checkCrossUserAttach(username string) error {
+	return nil
+}
@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/XHao/jvmtool/pkg"
+)
+
+// hsperfdataStaleAfter is how long a JVM may leave its hsperfdata file untouched before it is
+// considered unresponsive; HotSpot updates its counters many times a second.
+const hsperfdataStaleAfter = 5 * time.Second
+
+// diagnoseAttachTimeout returns the most likely reason why the JVM did not start its attach
+// listener within attachTimeout, or "" if there is no clue. The checks are ordered from the
+// most to the least certain cause.
+func (jp *JvmProcess) diagnoseAttachTimeout() string {
+	if exist, _ := pkg.PidExists(jp.Pid); !exist {
+		return "the process exited"
+	}
+	if cmdSlice, err := ProcessProvider(jp.Pid); err == nil && attachDisabled(cmdSlice) {
+		return "attach is disabled with -XX:+DisableAttachMechanism"
+	}
+	if dir, ok := jp.namespacedSocketDir(); ok {
+		return fmt.Sprintf("the JVM runs in another mount namespace and created its socket in %s, retry with -socket-dir %s", dir, dir)
+	}
+	if _, err := os.Stat(orTempDir(jp.SocketDir)); err != nil {
+		return fmt.Sprintf("the socket directory is not accessible: %v", err)
+	}
+	if modTime := jp.hsperfdataModTime(); modTime != nil {
+		if idle := time.Since(*modTime); idle > hsperfdataStaleAfter {
+			return fmt.Sprintf("the JVM has not updated its hsperfdata file for %s, it may be hung or stopped", idle.Round(time.Second))
+		}
+		return "the JVM is alive but did not start its attach listener, it may be busy, e.g. starting up or in a long GC pause"
+	}
+	return ""
+}
+
+// namespacedSocketDir returns the temp directory of a containerized JVM as seen from the host,
+// if its attach socket is there. Such a JVM names the socket after its pid in its own namespace.
+func (jp *JvmProcess) namespacedSocketDir() (string, bool) {
+	nsPid, err := pkg.NamespacedPid(jp.Pid)
+	if err != nil {
+		return "", false
+	}
+	dir := filepath.Join(pkg.ProcRoot, strconv.Itoa(int(jp.Pid)), "root", "tmp")
+	if dir == orTempDir(jp.SocketDir) || !pkg.PathExists(filepath.Join(dir, fmt.Sprintf(".java_pid%d", nsPid))) {
+		return "", false
+	}
+	return dir, true
+}
+
+// hsperfdataModTime returns the mtime of the hsperfdata file of the JVM under any user's directory.
+func (jp *JvmProcess) hsperfdataModTime() *time.Time {
+	users, err := hsperfdataUsers()
+	if err != nil {
+		return nil
+	}
+	for _, username := range users {
+		if modTime := hsperfdataModTime(username, jp.Pid); modTime != nil {
+			return modTime
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/XHao/jvmtool/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiagnoseAttachTimeout(t *testing.T) {
+	currentUser, err := user.Current()
+	if err != nil {
+		t.Fatalf("failed to get current user: %v", err)
+	}
+	origPidExists, origProvider, origProcRoot := pkg.PidExists, ProcessProvider, pkg.ProcRoot
+	defer func() { pkg.PidExists, ProcessProvider, pkg.ProcRoot = origPidExists, origProvider, origProcRoot }()
+	t.Setenv("TMPDIR", t.TempDir())
+	pkg.ProcRoot = t.TempDir()
+	jvmProc := JvmProcess{Pid: 4242, SocketDir: t.TempDir()}
+
+	pkg.PidExists = func(pid int32) (bool, error) { return false, nil }
+	assert.Equal(t, "the process exited", jvmProc.diagnoseAttachTimeout())
+
+	pkg.PidExists = func(pid int32) (bool, error) { return true, nil }
+	ProcessProvider = func(pid int32) ([]string, error) {
+		return []string{"java", "-XX:+DisableAttachMechanism", "com.example.App"}, nil
+	}
+	assert.Equal(t, "attach is disabled with -XX:+DisableAttachMechanism", jvmProc.diagnoseAttachTimeout())
+
+	ProcessProvider = func(pid int32) ([]string, error) { return []string{"java", "com.example.App"}, nil }
+	assert.Equal(t, "", jvmProc.diagnoseAttachTimeout())
+
+	hsperfFile, cleanup, err := prepareHsperfdataFile(currentUser.Username, 4242)
+	if err != nil {
+		t.Fatalf("failed to create hsperfdata file: %v", err)
+	}
+	defer cleanup()
+	assert.True(t, strings.HasPrefix(jvmProc.diagnoseAttachTimeout(), "the JVM is alive but did not start its attach listener"))
+
+	old := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(hsperfFile, old, old); err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, strings.HasPrefix(jvmProc.diagnoseAttachTimeout(), "the JVM has not updated its hsperfdata file for 1m0s"))
+
+	// a containerized JVM knows itself as pid 1 and created its socket in its own /tmp
+	writeFile := func(path string) {
+		full := filepath.Join(pkg.ProcRoot, path)
+		os.MkdirAll(filepath.Dir(full), 0755)
+		if err := os.WriteFile(full, []byte("NSpid:\t4242\t1\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("4242/status")
+	writeFile("4242/root/tmp/.java_pid1")
+	dir := filepath.Join(pkg.ProcRoot, "4242", "root", "tmp")
+	assert.Equal(t, "the JVM runs in another mount namespace and created its socket in "+dir+", retry with -socket-dir "+dir, jvmProc.diagnoseAttachTimeout())
+}
+
+// TestNamespacedSocketDir tests finding the socket of a containerized JVM under a fake proc root.
+func TestNamespacedSocketDir(t *testing.T) {
+	origProcRoot := pkg.ProcRoot
+	defer func() { pkg.ProcRoot = origProcRoot }()
+	pkg.ProcRoot = t.TempDir()
+	writeFile := func(path string, content string) {
+		full := filepath.Join(pkg.ProcRoot, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	containerTmp := filepath.Join(pkg.ProcRoot, "4242", "root", "tmp")
+
+	jvmProc := JvmProcess{Pid: 4242, SocketDir: t.TempDir()}
+	_, ok := jvmProc.namespacedSocketDir()
+	assert.False(t, ok, "no status file")
+
+	writeFile("4242/status", "NSpid:\t4242\t7\t1\n")
+	_, ok = jvmProc.namespacedSocketDir()
+	assert.False(t, ok, "no socket in the container")
+
+	// the socket is named after the innermost pid, not the host pid
+	writeFile("4242/root/tmp/.java_pid4242", "")
+	_, ok = jvmProc.namespacedSocketDir()
+	assert.False(t, ok, "socket named after the host pid")
+
+	writeFile("4242/root/tmp/.java_pid1", "")
+	dir, ok := jvmProc.namespacedSocketDir()
+	assert.True(t, ok)
+	assert.Equal(t, containerTmp, dir)
+
+	// nothing to suggest if the container directory is already the one searched
+	jvmProc.SocketDir = containerTmp
+	_, ok = jvmProc.namespacedSocketDir()
+	assert.False(t, ok, "socket dir already used")
+}
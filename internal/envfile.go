@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// envFileEnv names a .env-style file whose variables are applied before any flag is parsed.
+const envFileEnv = "JVMTOOL_ENV_FILE"
+
+// defaultEnvFile returns the env file used when JVMTOOL_ENV_FILE is unset, <config dir>/jvmtool/env.
+func defaultEnvFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "jvmtool", "env")
+}
+
+// LoadEnvFile sets the KEY=value pairs of the file named by JVMTOOL_ENV_FILE, or of the default
+// env file if it exists, as environment variables. Variables already set in the environment win.
+// A missing default file is not an error; a missing JVMTOOL_ENV_FILE is.
+func LoadEnvFile() error {
+	path := os.Getenv(envFileEnv)
+	if path == "" {
+		path = defaultEnvFile()
+		if path == "" {
+			return nil
+		}
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return nil
+		}
+	}
+	vars, err := readEnvFile(path)
+	if err != nil {
+		return err
+	}
+	for _, v := range vars {
+		if _, set := os.LookupEnv(v[0]); set {
+			continue
+		}
+		if err := os.Setenv(v[0], v[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readEnvFile parses a .env-style file: KEY=value lines, optionally prefixed with "export",
+// with blank lines and # comments ignored and matching surrounding quotes stripped from values.
+func readEnvFile(path string) ([][2]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read env file: %v", err)
+	}
+	defer f.Close()
+
+	var vars [][2]string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("env file %s line %d: expected KEY=value", path, n)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		vars = append(vars, [2]string{key, value})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read env file: %v", err)
+	}
+	return vars, nil
+}
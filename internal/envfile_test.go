@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadEnvFile_Precedence(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), "env")
+	content := "# jvmtool defaults\n" +
+		"\n" +
+		"JVMTOOL_BRIDGE_TOKEN=from-file\n" +
+		"export JVMTOOL_ALLOWED_AGENT_DIRS=\"/opt/agents:/srv/agents\"\n" +
+		"JVMTOOL_TEST_EMPTY=\n"
+	if err := os.WriteFile(envFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write env file: %v", err)
+	}
+	t.Setenv(envFileEnv, envFile)
+	t.Setenv(bridgeTokenEnv, "from-env")
+	// registered so that t.Setenv restores them; unset so that the file applies
+	t.Setenv(allowedAgentDirsEnv, "")
+	os.Unsetenv(allowedAgentDirsEnv)
+	t.Setenv("JVMTOOL_TEST_EMPTY", "")
+	os.Unsetenv("JVMTOOL_TEST_EMPTY")
+
+	assert.Nil(t, LoadEnvFile())
+	assert.Equal(t, "from-env", os.Getenv(bridgeTokenEnv))
+	assert.Equal(t, "/opt/agents:/srv/agents", os.Getenv(allowedAgentDirsEnv))
+	value, set := os.LookupEnv("JVMTOOL_TEST_EMPTY")
+	assert.True(t, set)
+	assert.Equal(t, "", value)
+}
+
+func TestLoadEnvFile_Errors(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(envFileEnv, filepath.Join(dir, "missing"))
+	assert.NotNil(t, LoadEnvFile())
+
+	envFile := filepath.Join(dir, "env")
+	if err := os.WriteFile(envFile, []byte("JVMTOOL_BRIDGE_TOKEN=x\nnot a pair\n"), 0644); err != nil {
+		t.Fatalf("failed to write env file: %v", err)
+	}
+	t.Setenv(envFileEnv, envFile)
+	assert.EqualError(t, LoadEnvFile(), "env file "+envFile+" line 2: expected KEY=value")
+
+	// a missing default env file is ignored
+	t.Setenv(envFileEnv, "")
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	assert.Nil(t, LoadEnvFile())
+}
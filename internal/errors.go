@@ -0,0 +1,40 @@
+package internal
+
+import "errors"
+
+// Sentinel errors returned (possibly wrapped) by the jps and jattach commands.
+// Callers should match them with errors.Is instead of comparing error strings.
+var (
+	ErrUserNotFound        = errors.New("user does not exist")
+	ErrPidRequired         = errors.New("pid is required")
+	ErrAgentPathRequired   = errors.New("agentpath is required")
+	ErrProcessNotFound     = errors.New("process not found")
+	ErrPidNotOwned         = errors.New("pid does not belong to the specified user")
+	ErrAgentPathNotAllowed = errors.New("agent path not in allowed directories")
+	ErrPermissionDenied    = errors.New("permission denied — possibly blocked by SELinux/AppArmor or wrong user; try running as the JVM owner")
+	ErrJvmExited           = errors.New("target JVM exited during attach")
+	ErrAttachDisabled      = errors.New("target JVM has the attach mechanism disabled")
+	ErrCrossUserAttach     = errors.New("must run as root to attach cross-user")
+	ErrAttachSelf          = errors.New("refusing to attach to self/parent")
+	ErrResponseTooLarge    = errors.New("response exceeds the size limit")
+	ErrPropertyNotFound    = errors.New("system property not found")
+
+	// load command failures reported by the JVM's instrument agent
+	ErrAgentClassMissing = errors.New("Agent JAR not found or no Agent-Class attribute")
+	ErrAgentClassPath    = errors.New("Unable to add JAR file to system class path")
+	ErrAgentMainFailed   = errors.New("No agentmain method or agentmain failed")
+)
+
+// userLookupError is a failed lookup of a user name. It keeps the message of the lookup error
+// and matches both it and ErrUserNotFound.
+type userLookupError struct {
+	err error
+}
+
+func (e *userLookupError) Error() string {
+	return e.err.Error()
+}
+
+func (e *userLookupError) Unwrap() []error {
+	return []error{ErrUserNotFound, e.err}
+}
@@ -0,0 +1,156 @@
+package internal
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+type ExecOption struct {
+	User        string
+	Pid         string
+	Cmd         string
+	MaxResponse int       // response size limit in bytes, 0 for unlimited
+	Out         io.Writer // results, os.Stdout if nil
+	ErrOut      io.Writer // errors, os.Stderr if nil
+}
+
+// ParseExecFlags parses flags for the "exec" command and returns the corresponding ExecOption.
+func ParseExecFlags(args []string) (ExecOption, error) {
+	execFlagSet := flag.NewFlagSet("exec", flag.ContinueOnError)
+	user := execFlagSet.String("user", "", "specify the user owning the Java process")
+	pid := execFlagSet.String("pid", "", "specify the pid of the Java process")
+	cmd := execFlagSet.String("cmd", "", "specify the diagnostic command to run, e.g. \"Thread.print -l\"")
+	maxResponse := execFlagSet.Int("maxresponse", defaultMaxResponseSize, "specify the response size limit in bytes, 0 for unlimited")
+	if err := execFlagSet.Parse(args); err != nil {
+		return ExecOption{}, err
+	}
+	return ExecOption{
+		User:        *user,
+		Pid:         *pid,
+		Cmd:         *cmd,
+		MaxResponse: *maxResponse,
+	}, nil
+}
+
+// ExecValidate validates the ExecOption fields.
+func (opt *ExecOption) ExecValidate() error {
+	opt.Cmd = strings.TrimSpace(opt.Cmd)
+	if opt.Cmd == "" {
+		return errors.New("cmd is required")
+	}
+	// a NUL byte would terminate the attach protocol argument early
+	if strings.ContainsRune(opt.Cmd, 0) {
+		return errors.New("cmd must not contain NUL bytes")
+	}
+	if err := checkAgentLoadCmd(opt.Cmd); err != nil {
+		return err
+	}
+	username, err := validateTarget(opt.User, opt.Pid)
+	if err != nil {
+		return err
+	}
+	opt.User = username
+	return nil
+}
+
+// agentLoadCmd is the diagnostic command that loads a JVMTI agent library into the JVM.
+const agentLoadCmd = "JVMTI.agent_load"
+
+// checkAgentLoadCmd applies the allowed agent directories to a JVMTI.agent_load command, so that
+// exec cannot load agents jattach would refuse. Other commands are not checked.
+func checkAgentLoadCmd(cmd string) error {
+	if os.Getenv(allowedAgentDirsEnv) == "" {
+		return nil
+	}
+	args, err := splitDcmdArgs(cmd)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 || args[0] != agentLoadCmd {
+		return nil
+	}
+	// the library is the first argument, given by position or as library=<path>
+	library := ""
+	for _, arg := range args[1:] {
+		if value, ok := strings.CutPrefix(arg, "library="); ok {
+			library = value
+			break
+		}
+		if library == "" && !strings.Contains(arg, "=") {
+			library = arg
+		}
+	}
+	if library == "" {
+		return fmt.Errorf("%s requires a library path", agentLoadCmd)
+	}
+	return checkAgentDir(library)
+}
+
+// splitDcmdArgs splits a diagnostic command at spaces the way the JVM does, keeping
+// single- or double-quoted parts together and dropping the quotes.
+func splitDcmdArgs(cmd string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	for _, r := range cmd {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inArg = r, true
+		case r == ' ':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("cmd has an unterminated quote")
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// Exec runs a single diagnostic command in the target JVM and prints its output as it arrives.
+func Exec(option ExecOption) int {
+	o := newOutput(option.Out, option.ErrOut)
+	if err := option.ExecValidate(); err != nil {
+		o.printError(err)
+		return 1
+	}
+
+	jp := &JvmProcess{
+		Pid:             toInt32(option.Pid),
+		MaxResponseSize: option.MaxResponse,
+	}
+	if err := jp.checkSocket(); err != nil {
+		o.printError(err)
+		return 1
+	}
+
+	err := jp.jcmdStream(option.Cmd, func(line string) error {
+		o.print(line)
+		return nil
+	})
+	if err != nil {
+		o.printError(err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestExecValidate tests validation of the diagnostic command string.
+func TestExecValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		option   ExecOption
+		expected string
+	}{
+		{name: "empty cmd", option: ExecOption{Pid: "12345", Cmd: "  "}, expected: "cmd is required"},
+		{name: "nul byte", option: ExecOption{Pid: "12345", Cmd: "Thread.print\x00load"}, expected: "cmd must not contain NUL bytes"},
+		{name: "missing pid", option: ExecOption{Cmd: "Thread.print -l"}, expected: ErrPidRequired.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.option.ExecValidate()
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("expected error '%s', got: %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+// TestExecValidate_AgentLoad tests that JVMTI.agent_load is held to the allowed agent directories.
+func TestExecValidate_AgentLoad(t *testing.T) {
+	agentDir := t.TempDir()
+	agentPath := filepath.Join(agentDir, "libagent.so")
+	if err := os.WriteFile(agentPath, nil, 0644); err != nil {
+		t.Fatalf("failed to create agent: %v", err)
+	}
+	otherPath := filepath.Join(t.TempDir(), "libagent.so")
+	if err := os.WriteFile(otherPath, nil, 0644); err != nil {
+		t.Fatalf("failed to create agent: %v", err)
+	}
+	t.Setenv(allowedAgentDirsEnv, agentDir)
+
+	tests := []struct {
+		name     string
+		cmd      string
+		expected error
+	}{
+		{name: "allowed", cmd: "JVMTI.agent_load " + agentPath + " opts"},
+		{name: "allowed by name", cmd: "JVMTI.agent_load library=" + agentPath},
+		{name: "not allowed", cmd: "JVMTI.agent_load " + otherPath, expected: ErrAgentPathNotAllowed},
+		{name: "not allowed quoted", cmd: `JVMTI.agent_load "` + otherPath + `" "a b"`, expected: ErrAgentPathNotAllowed},
+		{name: "not allowed by name", cmd: "JVMTI.agent_load  library=" + otherPath, expected: ErrAgentPathNotAllowed},
+		{name: "other command", cmd: "Thread.print -l"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkAgentLoadCmd(tt.cmd)
+			if tt.expected == nil {
+				assert.Nil(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.expected)
+			}
+		})
+	}
+
+	opt := ExecOption{Pid: "12345", Cmd: "JVMTI.agent_load"}
+	assert.EqualError(t, opt.ExecValidate(), "JVMTI.agent_load requires a library path")
+	opt = ExecOption{Pid: "12345", Cmd: `JVMTI.agent_load "` + agentPath}
+	assert.EqualError(t, opt.ExecValidate(), "cmd has an unterminated quote")
+}
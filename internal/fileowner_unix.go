@@ -0,0 +1,23 @@
+//go:build unix
+
+package internal
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// fileOwnedBy reports whether the file described by info is owned by username.
+func fileOwnedBy(info os.FileInfo, username string) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false
+	}
+	u, err := user.Lookup(username)
+	if err != nil {
+		return false
+	}
+	return strconv.FormatUint(uint64(stat.Uid), 10) == u.Uid
+}
@@ -0,0 +1,149 @@
+package internal
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// defaultFlagOrigin is the origin HotSpot reports for flags left at their default value.
+const defaultFlagOrigin = "default"
+
+type FlagsOption struct {
+	User   string
+	Pid    string
+	Diff   bool      // -diff
+	Out    io.Writer // results, os.Stdout if nil
+	ErrOut io.Writer // errors, os.Stderr if nil
+}
+
+// ParseFlagsFlags parses flags for the "flags" command and returns the corresponding FlagsOption.
+func ParseFlagsFlags(args []string) (FlagsOption, error) {
+	flagsFlagSet := flag.NewFlagSet("flags", flag.ContinueOnError)
+	user := flagsFlagSet.String("user", "", "specify the user owning the Java process")
+	pid := flagsFlagSet.String("pid", "", "specify the pid of the Java process")
+	diff := flagsFlagSet.Bool("diff", false, "only show flags whose value differs from the default")
+	if err := flagsFlagSet.Parse(args); err != nil {
+		return FlagsOption{}, err
+	}
+	return FlagsOption{
+		User: *user,
+		Pid:  *pid,
+		Diff: *diff,
+	}, nil
+}
+
+// FlagsValidate validates the FlagsOption fields.
+func (opt *FlagsOption) FlagsValidate() error {
+	username, err := validateTarget(opt.User, opt.Pid)
+	if err != nil {
+		return err
+	}
+	opt.User = username
+	return nil
+}
+
+// Flags prints the VM flags of the target JVM, optionally only those not at their default value.
+func Flags(option FlagsOption) int {
+	o := newOutput(option.Out, option.ErrOut)
+	if err := option.FlagsValidate(); err != nil {
+		o.printError(err)
+		return 1
+	}
+
+	jp := &JvmProcess{
+		Pid: toInt32(option.Pid),
+	}
+	if err := jp.checkSocket(); err != nil {
+		o.printError(err)
+		return 1
+	}
+
+	output, err := jp.jcmd("VM.flags -all")
+	if err != nil {
+		o.printError(err)
+		return 1
+	}
+	entries := parseVMFlags(output)
+	if len(entries) == 0 {
+		o.printError(errors.New("no VM flags in the VM.flags output"))
+		return 1
+	}
+	printVMFlags(o, entries, option.Diff)
+	return 0
+}
+
+// printVMFlags prints "<name>=<value> (<origin>)" lines, skipping flags at their default if diff is set.
+func printVMFlags(o *output, entries []VMFlagEntry, diff bool) {
+	for _, e := range entries {
+		if diff && e.Origin == defaultFlagOrigin {
+			continue
+		}
+		o.print(fmt.Sprintf("%s=%s (%s)", e.Name, e.Value, e.Origin))
+	}
+}
+
+// VMFlagEntry is a flag reported by the VM.flags diagnostic command.
+type VMFlagEntry struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Value  string `json:"value"`
+	Origin string `json:"origin"`
+}
+
+// parseVMFlags parses the output of "VM.flags -all". Since JDK 9 each line reads
+// "<type> <name> = <value> {<kind>} {<origin>}". JDK 8 prints only the kind and marks
+// flags changed from the default with ":=" instead of "=", reported as origin "non-default".
+func parseVMFlags(output string) []VMFlagEntry {
+	var entries []VMFlagEntry
+	for _, line := range strings.Split(output, "\n") {
+		left, right, sep := cutFlagAssignment(line)
+		if sep == "" {
+			continue
+		}
+		fields := strings.Fields(left)
+		if len(fields) != 2 {
+			continue
+		}
+
+		// peel the trailing "{...}" groups off the value
+		var groups []string
+		right = strings.TrimSpace(right)
+		for strings.HasSuffix(right, "}") {
+			open := strings.LastIndex(right, "{")
+			if open < 0 {
+				break
+			}
+			groups = append([]string{right[open+1 : len(right)-1]}, groups...)
+			right = strings.TrimSpace(right[:open])
+		}
+
+		entry := VMFlagEntry{Type: fields[0], Name: fields[1], Value: right, Origin: defaultFlagOrigin}
+		switch {
+		case len(groups) >= 2:
+			entry.Origin = groups[len(groups)-1]
+		case sep == ":=":
+			entry.Origin = "non-default"
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// cutFlagAssignment splits a VM.flags line around its " = " or " := " separator.
+func cutFlagAssignment(line string) (left string, right string, sep string) {
+	for _, sep := range []string{" := ", " = "} {
+		if left, right, ok := strings.Cut(line, sep); ok {
+			return left, right, strings.TrimSpace(sep)
+		}
+	}
+	// an unset ccstr flag may end the line right after the separator
+	for _, sep := range []string{" :=", " ="} {
+		if left, ok := strings.CutSuffix(strings.TrimRight(line, " "), sep); ok {
+			return left, "", strings.TrimSpace(sep)
+		}
+	}
+	return "", "", ""
+}
@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVMFlags(t *testing.T) {
+	output := "[Global flags]\n" +
+		"     bool AlwaysPreTouch                           = false                                     {product} {default}\n" +
+		"   size_t MaxHeapSize                              = 4294967296                                {product} {ergonomic}\n" +
+		"     bool UseG1GC                                  = true                                      {product} {command line}\n" +
+		"    ccstr ErrorFile                                =                                           {product} {default}\n" +
+		"ccstrlist OnError                                  = \n" +
+		"    uintx NewSize                                 := 1048576                                   {product}\n"
+	entries := parseVMFlags(output)
+	assert.Equal(t, []VMFlagEntry{
+		{Name: "AlwaysPreTouch", Type: "bool", Value: "false", Origin: "default"},
+		{Name: "MaxHeapSize", Type: "size_t", Value: "4294967296", Origin: "ergonomic"},
+		{Name: "UseG1GC", Type: "bool", Value: "true", Origin: "command line"},
+		{Name: "ErrorFile", Type: "ccstr", Value: "", Origin: "default"},
+		{Name: "OnError", Type: "ccstrlist", Value: "", Origin: "default"},
+		{Name: "NewSize", Type: "uintx", Value: "1048576", Origin: "non-default"},
+	}, entries)
+}
+
+func TestFlags_Diff(t *testing.T) {
+	jvmProc := JvmProcess{Pid: 12345, connect: fakeJvmConnect("0\n" +
+		"     bool AlwaysPreTouch = false {product} {default}\n" +
+		"     bool UseG1GC = true {product} {command line}\n")}
+	output, err := jvmProc.jcmd("VM.flags -all")
+	assert.Nil(t, err)
+	entries := parseVMFlags(output)
+
+	var out bytes.Buffer
+	printVMFlags(newOutput(&out, nil), entries, true)
+	assert.Equal(t, []string{"UseG1GC=true (command line)"}, outputLines(&out))
+
+	out.Reset()
+	printVMFlags(newOutput(&out, nil), entries, false)
+	assert.Equal(t, []string{"AlwaysPreTouch=false (default)", "UseG1GC=true (command line)"}, outputLines(&out))
+}
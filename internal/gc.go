@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type GcOption struct {
+	User   string
+	Pid    string
+	Out    io.Writer // results, os.Stdout if nil
+	ErrOut io.Writer // errors, os.Stderr if nil
+}
+
+// ParseGcFlags parses flags for the "gc" command and returns the corresponding GcOption.
+func ParseGcFlags(args []string) (GcOption, error) {
+	gcFlagSet := flag.NewFlagSet("gc", flag.ContinueOnError)
+	user := gcFlagSet.String("user", "", "specify the user owning the Java process")
+	pid := gcFlagSet.String("pid", "", "specify the pid of the Java process to collect")
+	if err := gcFlagSet.Parse(args); err != nil {
+		return GcOption{}, err
+	}
+	return GcOption{
+		User: *user,
+		Pid:  *pid,
+	}, nil
+}
+
+// GcValidate validates the GcOption fields.
+func (opt *GcOption) GcValidate() error {
+	username, err := validateTarget(opt.User, opt.Pid)
+	if err != nil {
+		return err
+	}
+	opt.User = username
+	return nil
+}
+
+// Gc triggers a garbage collection in the target JVM through the GC.run diagnostic command.
+// GC.run is System.gc(), which is already a full collection unless the JVM runs with
+// -XX:+ExplicitGCInvokesConcurrent; HotSpot has no attach command for a young-only collection.
+func Gc(option GcOption) int {
+	o := newOutput(option.Out, option.ErrOut)
+	if err := option.GcValidate(); err != nil {
+		o.printError(err)
+		return 1
+	}
+
+	jp := &JvmProcess{
+		Pid: toInt32(option.Pid),
+	}
+	if err := jp.checkSocket(); err != nil {
+		o.printError(err)
+		return 1
+	}
+	return gc(o, jp, GetHsperfdataPath(option.User, option.Pid))
+}
+
+// gc runs GC.run and reports the heap usage read from the hsperfdata file at path before and
+// after. The usage is left out if the file cannot be read, e.g. with -XX:-UsePerfData.
+func gc(o *output, jp *JvmProcess, path string) int {
+	o.warn("forcing a GC runs a full collection and pauses the application")
+	before, beforeErr := gcHeapUsed(path)
+	output, err := jp.jcmd("GC.run")
+	if err != nil {
+		o.printError(err)
+		return 1
+	}
+	if output = strings.TrimSpace(output); output != "" {
+		o.print(output)
+	}
+	o.print("GC completed")
+	after, afterErr := gcHeapUsed(path)
+	if beforeErr != nil || afterErr != nil {
+		return 0
+	}
+	o.print(fmt.Sprintf("heap used: %dK -> %dK (%+dK)", before>>10, after>>10, (after-before)>>10))
+	return 0
+}
+
+// gcHeapUsed returns the bytes used in all heap spaces, as summed by vmstat.
+func gcHeapUsed(path string) (int64, error) {
+	perfData, err := vmstatReader(path)
+	if err != nil {
+		return 0, err
+	}
+	return readVmstatCounters(perfData).heapUsed, nil
+}
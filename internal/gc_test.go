@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/XHao/jvmtool/pkg"
+)
+
+// TestParseGcFlags tests the ParseGcFlags function.
+func TestParseGcFlags(t *testing.T) {
+	opt, err := ParseGcFlags([]string{"-user", "testuser", "-pid", "12345"})
+	if err != nil {
+		t.Fatalf("ParseGcFlags failed: %v", err)
+	}
+	if opt.User != "testuser" || opt.Pid != "12345" {
+		t.Errorf("unexpected option: %+v", opt)
+	}
+}
+
+// TestGcValidate tests that GcValidate requires a pid.
+func TestGcValidate(t *testing.T) {
+	opt := GcOption{}
+	if err := opt.GcValidate(); !errors.Is(err, ErrPidRequired) {
+		t.Errorf("expected ErrPidRequired, got: %v", err)
+	}
+}
+
+// writePerfDataFile writes a little-endian hsperfdata v2 file with the given long counters.
+func writePerfDataFile(t *testing.T, path string, longs map[string]int64) {
+	t.Helper()
+	const prologueSize, entryHeaderLen = 32, 20
+	var entries []byte
+	for name, v := range longs {
+		nameBytes := append([]byte(name), 0)
+		dataOffset := entryHeaderLen + len(nameBytes)
+		entry := make([]byte, entryHeaderLen)
+		binary.LittleEndian.PutUint32(entry, uint32(dataOffset+8))
+		binary.LittleEndian.PutUint32(entry[4:], entryHeaderLen)
+		entry[12] = 'J'
+		entry[14] = 4
+		entry[15] = 3
+		binary.LittleEndian.PutUint32(entry[16:], uint32(dataOffset))
+		entry = append(entry, nameBytes...)
+		entry = binary.LittleEndian.AppendUint64(entry, uint64(v))
+		entries = append(entries, entry...)
+	}
+	prologue := make([]byte, prologueSize)
+	binary.BigEndian.PutUint32(prologue, pkg.PerfDataMagic)
+	prologue[4] = 1
+	prologue[5] = 2
+	prologue[7] = 1
+	binary.LittleEndian.PutUint32(prologue[8:], uint32(prologueSize+len(entries)))
+	binary.LittleEndian.PutUint32(prologue[24:], prologueSize)
+	binary.LittleEndian.PutUint32(prologue[28:], uint32(len(longs)))
+	if err := os.WriteFile(path, append(prologue, entries...), 0644); err != nil {
+		t.Fatalf("failed to write perfdata file: %v", err)
+	}
+}
+
+// TestGc_HeapUsage tests reporting the heap usage read from hsperfdata before and after GC.run.
+func TestGc_HeapUsage(t *testing.T) {
+	var out, errOut bytes.Buffer
+	o := newOutput(&out, &errOut)
+	path := filepath.Join(t.TempDir(), "12345")
+	writePerfDataFile(t, path, map[string]int64{
+		"sun.gc.generation.0.space.0.used": 6 << 20,
+		"sun.gc.generation.1.space.0.used": 10 << 20,
+	})
+	jp := &JvmProcess{Pid: 12345, connect: func(pid int32) (net.Conn, error) {
+		// the collection happens while the command runs
+		writePerfDataFile(t, path, map[string]int64{
+			"sun.gc.generation.0.space.0.used": 0,
+			"sun.gc.generation.1.space.0.used": 4 << 20,
+		})
+		return fakeJvmConnect("0\n")(pid)
+	}}
+	if code := gc(o, jp, path); code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+	logs := outputLines(&out)
+	if logs[len(logs)-1] != "heap used: 16384K -> 4096K (-12288K)" {
+		t.Errorf("unexpected heap usage line: %v", logs)
+	}
+	if !strings.HasPrefix(errOut.String(), "warning: forcing a GC") {
+		t.Errorf("expected the pause warning on the error output, got %q", errOut.String())
+	}
+
+	// without a readable hsperfdata file the usage is left out
+	if code := gc(o, &JvmProcess{Pid: 12345, connect: fakeJvmConnect("0\n")}, filepath.Join(t.TempDir(), "missing")); code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+	if logs := outputLines(&out); logs[len(logs)-1] != "GC completed" {
+		t.Errorf("expected no heap usage line, got: %v", logs)
+	}
+}
@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// errorHints maps sentinel errors to a short suggestion of what to do about them.
+var errorHints = map[error]string{
+	ErrUserNotFound:        "check the user name; `jvmtool scan -all` lists the users running Java processes",
+	ErrPidRequired:         "find the pid with `jvmtool jps`",
+	ErrProcessNotFound:     "the process may have exited; list the running JVMs with `jvmtool jps`",
+	ErrPidNotOwned:         "verify the pid with `jvmtool jps -user <owner>` and that you are the process owner or root",
+	ErrAgentPathNotAllowed: "move the agent into one of the directories of " + allowedAgentDirsEnv,
+	ErrPermissionDenied:    "run jvmtool as the user owning the JVM, e.g. with sudo -u <owner>",
+	ErrJvmExited:           "check the JVM's output or hs_err_pid file for a crash",
+	ErrAttachDisabled:      "restart the JVM without -XX:+DisableAttachMechanism",
+	ErrAttachSelf:          "check the pid with `jvmtool jps`, or pass -force if attaching to jvmtool's own launcher is intended",
+	ErrCrossUserAttach:     "run jvmtool as the JVM owner, e.g. with sudo -u <owner>, or as root",
+	ErrAgentClassMissing:   "check that the agent jar exists and its manifest has an Agent-Class attribute",
+	ErrAgentMainFailed:     "check the agent class for an agentmain method and the JVM's output for its exception",
+}
+
+// errorHint returns the hint for the outermost error in the tree of err that has one, or "".
+// Errors wrapping several errors, e.g. a cause and a sentinel, are searched depth-first.
+func errorHint(err error) string {
+	if err == nil {
+		return ""
+	}
+	if hint, ok := errorHints[err]; ok {
+		return hint
+	}
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		return errorHint(e.Unwrap())
+	case interface{ Unwrap() []error }:
+		for _, wrapped := range e.Unwrap() {
+			if hint := errorHint(wrapped); hint != "" {
+				return hint
+			}
+		}
+	}
+	return ""
+}
+
+// isTerminal reports whether w is a terminal. It is a variable so that tests can replace it.
+var isTerminal = func(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// printError writes err to the error writer and, when a person is likely reading it, a hint of
+// how to fix it. Hints are left out when the error writer is a file, a pipe or a buffer, so that
+// scripts do not see them.
+func (o *output) printError(err error) {
+	fmt.Fprintln(o.errOut, err.Error())
+	if hint := errorHint(err); hint != "" && isTerminal(o.errOut) {
+		fmt.Fprintln(o.errOut, "hint: "+hint)
+	}
+}
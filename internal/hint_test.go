@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorHint(t *testing.T) {
+	assert.Equal(t, errorHints[ErrPidNotOwned], errorHint(ErrPidNotOwned))
+	assert.Equal(t, errorHints[ErrUserNotFound], errorHint(fmt.Errorf("%w: bob", ErrUserNotFound)))
+	assert.Equal(t, errorHints[ErrPermissionDenied], errorHint(fmt.Errorf("dial: %w; %w", syscall.EACCES, ErrPermissionDenied)))
+	assert.Equal(t, "", errorHint(ErrResponseTooLarge))
+	assert.Equal(t, "", errorHint(nil))
+}
+
+// TestPrintError tests that hints are printed only when the error writer is a terminal.
+func TestPrintError(t *testing.T) {
+	origIsTerminal := isTerminal
+	defer func() { isTerminal = origIsTerminal }()
+	var errOut strings.Builder
+	o := newOutput(nil, &errOut)
+
+	isTerminal = func(w io.Writer) bool { return false }
+	o.printError(ErrPidNotOwned)
+	assert.Equal(t, ErrPidNotOwned.Error()+"\n", errOut.String())
+
+	errOut.Reset()
+	isTerminal = func(w io.Writer) bool { return w == &errOut }
+	o.printError(ErrPidNotOwned)
+	assert.Equal(t, ErrPidNotOwned.Error()+"\nhint: "+errorHints[ErrPidNotOwned]+"\n", errOut.String())
+}
+
+// TestIsTerminal tests that writers other than a terminal file are not terminals.
+func TestIsTerminal(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "out")
+	if err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	defer f.Close()
+	assert.False(t, isTerminal(f))
+	assert.False(t, isTerminal(&strings.Builder{}))
+}
@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/XHao/jvmtool/pkg"
+)
+
+// hsperfdataDirs returns the candidate hsperfdata directories of username: first under the
+// symlink-resolved temp dir, then under os.TempDir() as returned. On macOS /tmp links to
+// /private/tmp, and a JVM may have resolved it differently from us.
+func hsperfdataDirs(username string) []string {
+	username = hsperfdataUsername(username)
+	tempDir := os.TempDir()
+	dirs := []string{}
+	if resolved, err := filepath.EvalSymlinks(tempDir); err == nil && resolved != tempDir {
+		dirs = append(dirs, filepath.Join(resolved, "hsperfdata_"+username))
+	}
+	return append(dirs, filepath.Join(tempDir, "hsperfdata_"+username))
+}
+
+// GetHsperfdataDir returns the hsperfdata directory of username, with symlinks in the temp dir resolved.
+func GetHsperfdataDir(username string) string {
+	return hsperfdataDirs(username)[0]
+}
+
+// GetHsperfdataPath returns the hsperfdata file of the given pid, probing every candidate
+// directory and falling back to the one under GetHsperfdataDir.
+func GetHsperfdataPath(username string, pid string) string {
+	for _, dir := range hsperfdataDirs(username) {
+		path := filepath.Join(dir, fmt.Sprint(pid))
+		if pkg.PathExists(path) {
+			return path
+		}
+	}
+	return filepath.Join(GetHsperfdataDir(username), fmt.Sprint(pid))
+}
+
+// hsperfdataUsers returns the sorted usernames owning an hsperfdata directory in any candidate temp dir.
+func hsperfdataUsers() ([]string, error) {
+	seen := map[string]bool{}
+	users := []string{}
+	for _, pattern := range hsperfdataDirs("*") {
+		dirs, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, dir := range dirs {
+			username := strings.TrimPrefix(filepath.Base(dir), "hsperfdata_")
+			if username != "" && !seen[username] {
+				seen[username] = true
+				users = append(users, username)
+			}
+		}
+	}
+	sort.Strings(users)
+	return users, nil
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package internal
+
+// hsperfdataUsername returns the username as HotSpot uses it in the hsperfdata directory name.
+func hsperfdataUsername(username string) string {
+	return username
+}
@@ -0,0 +1,43 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// TestGetHsperfdataDir_SymlinkedTemp models macOS, where /tmp is a symlink to /private/tmp:
+// the temp dir is a symlink, and the JVM created its hsperfdata file under the resolved path.
+func TestGetHsperfdataDir_SymlinkedTemp(t *testing.T) {
+	realTemp := t.TempDir()
+	linkTemp := filepath.Join(t.TempDir(), "tmp")
+	if err := os.Symlink(realTemp, linkTemp); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+	resolvedTemp, err := filepath.EvalSymlinks(realTemp)
+	if err != nil {
+		t.Fatalf("failed to resolve temp dir: %v", err)
+	}
+	t.Setenv("TMPDIR", linkTemp)
+
+	dir := GetHsperfdataDir("alice")
+	if dir != filepath.Join(resolvedTemp, "hsperfdata_alice") {
+		t.Errorf("expected hsperfdata dir under %s, got %s", resolvedTemp, dir)
+	}
+
+	pid := strconv.Itoa(os.Getpid())
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("failed to create hsperfdata dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, pid), nil, 0644); err != nil {
+		t.Fatalf("failed to create hsperfdata file: %v", err)
+	}
+	if path := GetHsperfdataPath("alice", pid); path != filepath.Join(dir, pid) {
+		t.Errorf("expected %s, got %s", filepath.Join(dir, pid), path)
+	}
+	pids, err := DiscoverJavaProcesses("alice")
+	if err != nil || len(pids) != 1 || pids[0] != int32(os.Getpid()) {
+		t.Errorf("expected to discover pid %s, got %v, %v", pid, pids, err)
+	}
+}
@@ -0,0 +1,42 @@
+//go:build windows
+
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/XHao/jvmtool/pkg"
+)
+
+// hsperfdataUsername returns the username as HotSpot uses it in the hsperfdata directory name.
+// On Windows user.User.Username is "DOMAIN\user", while the JVM only uses the account name.
+// Windows usernames are case-insensitive, so the case of an existing directory is preferred.
+func hsperfdataUsername(username string) string {
+	if i := strings.LastIndex(username, `\`); i >= 0 {
+		username = username[i+1:]
+	}
+	if username == "*" || pkg.PathExists(filepath.Join(os.TempDir(), "hsperfdata_"+username)) {
+		return username
+	}
+	dirs, err := filepath.Glob(filepath.Join(os.TempDir(), "hsperfdata_*"))
+	if err != nil {
+		return username
+	}
+	names := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		names = append(names, strings.TrimPrefix(filepath.Base(dir), "hsperfdata_"))
+	}
+	return matchUsernameFold(username, names)
+}
+
+// matchUsernameFold returns the first of names equal to username ignoring case, or username.
+func matchUsernameFold(username string, names []string) string {
+	for _, name := range names {
+		if strings.EqualFold(name, username) {
+			return name
+		}
+	}
+	return username
+}
@@ -0,0 +1,60 @@
+//go:build windows
+
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestGetHsperfdataDir_Windows tests that the domain is stripped from the username
+// and that the directory is placed under %TEMP%.
+func TestGetHsperfdataDir_Windows(t *testing.T) {
+	temp := t.TempDir()
+	t.Setenv("TMP", temp)
+	t.Setenv("TEMP", temp)
+	resolved, err := filepath.EvalSymlinks(temp)
+	if err != nil {
+		t.Fatalf("failed to resolve temp dir: %v", err)
+	}
+
+	for _, username := range []string{`CORP\alice`, "alice"} {
+		if dir := GetHsperfdataDir(username); dir != filepath.Join(resolved, "hsperfdata_alice") {
+			t.Errorf("expected hsperfdata dir for %s under %s, got %s", username, resolved, dir)
+		}
+	}
+	if path := GetHsperfdataPath(`CORP\alice`, "1234"); path != filepath.Join(resolved, "hsperfdata_alice", "1234") {
+		t.Errorf("unexpected hsperfdata path: %s", path)
+	}
+	if dirs := hsperfdataDirs(`CORP\alice`); dirs[len(dirs)-1] != filepath.Join(os.TempDir(), "hsperfdata_alice") {
+		t.Errorf("unexpected hsperfdata dirs: %v", dirs)
+	}
+}
+
+// TestMatchUsernameFold tests that the directory's case wins for a differently cased username.
+func TestMatchUsernameFold(t *testing.T) {
+	names := []string{"bob", "alice"}
+	for username, expected := range map[string]string{"Alice": "alice", "ALICE": "alice", "bob": "bob", "carol": "carol"} {
+		if name := matchUsernameFold(username, names); name != expected {
+			t.Errorf("expected %s for %s, got %s", expected, username, name)
+		}
+	}
+}
+
+// TestDiscoverJavaProcesses_UsernameCase tests that -user Alice finds the processes under hsperfdata_alice.
+func TestDiscoverJavaProcesses_UsernameCase(t *testing.T) {
+	temp := t.TempDir()
+	t.Setenv("TMP", temp)
+	t.Setenv("TEMP", temp)
+	if _, cleanup, err := prepareHsperfdataFile("alice", os.Getpid()); err != nil {
+		t.Fatalf("failed to create hsperfdata file: %v", err)
+	} else {
+		defer cleanup()
+	}
+
+	pids, err := DiscoverJavaProcesses(`CORP\Alice`)
+	if err != nil || len(pids) != 1 || pids[0] != int32(os.Getpid()) {
+		t.Errorf("expected pid %d, got %v, %v", os.Getpid(), pids, err)
+	}
+}
@@ -1,21 +1,44 @@
 package internal
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/user"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/XHao/jvmtool/pkg"
 	"github.com/shirou/gopsutil/process"
 )
 
 type JattachOption struct {
-	User        string
-	Pid         string
-	AgentPath   string
-	AgentParams string
+	User         string
+	Pid          string
+	AgentPath    string
+	AgentParams  string
+	Class        string        // main class or jar used to resolve Pid
+	Port         int           // TCP port the Java process listens on, used to resolve Pid
+	Protocol     string        // attach protocol version
+	Remote       string        // host:port of a jvmtool bridge
+	Token        string        // auth token shared with the bridge
+	PrintPaths   bool          // print the socket and attach file paths before attaching
+	SocketDir    string        // directory of the .java_pid socket
+	AttachDir    string        // directory of the .attach_pid trigger file
+	Json         bool          // print the result as JSON
+	MaxResponse  int           // response size limit in bytes, 0 for unlimited
+	Signal       string        // signal that asks the JVM to start its attach listener
+	Format       string        // Go template for the result, see jattachTemplateData
+	PollInterval time.Duration // how often to look for the attach socket
+	Quiet        bool          // suppress progress messages
+	Force        bool          // allow attaching to jvmtool itself or its parent
+	Out          io.Writer     // results, os.Stdout if nil
+	ErrOut       io.Writer     // errors, os.Stderr if nil
 }
 
 // ParseJattachFlags parses flags for the "jattach" command and returns the corresponding JattachOption.
@@ -25,47 +48,282 @@ func ParseJattachFlags(args []string) (JattachOption, error) {
 	pid := jattachFlagSet.String("pid", "", "specify the pid of the Java process to attach to")
 	agentPath := jattachFlagSet.String("agentpath", "", "specify the path to the Java agent jar")
 	agentParams := jattachFlagSet.String("agentparams", "", "specify the parameters for the Java agent")
+	class := jattachFlagSet.String("class", "", "specify the main class or jar of the Java process to attach to, instead of -pid")
+	port := jattachFlagSet.Int("port", 0, "specify a TCP port the Java process to attach to listens on, instead of -pid")
+	protocol := jattachFlagSet.String("protocol", defaultProtocolVersion, "specify the attach protocol version")
+	remote := jattachFlagSet.String("remote", "", "attach through a jvmtool bridge at host:port")
+	token := jattachFlagSet.String("token", os.Getenv(bridgeTokenEnv), "specify the auth token for the bridge")
+	printPaths := jattachFlagSet.Bool("print-paths", false, "print the attach socket and trigger file paths")
+	socketDir := jattachFlagSet.String("socket-dir", "", "specify the directory of the attach socket")
+	attachDir := jattachFlagSet.String("attach-dir", "", "specify the directory of the attach trigger file")
+	jsonOutput := jattachFlagSet.Bool("json", false, "print the attach result, including the decoded JVM response, as JSON")
+	maxResponse := jattachFlagSet.Int("maxresponse", defaultMaxResponseSize, "specify the response size limit in bytes, 0 for unlimited")
+	format := jattachFlagSet.String("format", "", "print the result with a Go template over {{.Pid}}, {{.AgentPath}}, {{.Success}}, {{.ResponseCode}} and {{.Message}}")
+	pollInterval := jattachFlagSet.Duration("poll-interval", defaultPollInterval, "specify how often to look for the attach socket while the JVM starts its listener")
+	signal := jattachFlagSet.String("signal", "QUIT", "specify the signal that starts the attach listener, QUIT or none")
+	quiet := jattachFlagSet.Bool("quiet", false, "only print the result, without progress messages")
+	force := jattachFlagSet.Bool("force", false, "allow attaching to the jvmtool process or its parent")
 	if err := jattachFlagSet.Parse(args); err != nil {
 		return JattachOption{}, err
 	}
 	return JattachOption{
-		User:        *user,
-		Pid:         *pid,
-		AgentPath:   *agentPath,
-		AgentParams: *agentParams,
+		User:         *user,
+		Pid:          *pid,
+		AgentPath:    *agentPath,
+		AgentParams:  *agentParams,
+		Class:        *class,
+		Port:         *port,
+		Protocol:     *protocol,
+		Remote:       *remote,
+		Token:        *token,
+		PrintPaths:   *printPaths,
+		SocketDir:    *socketDir,
+		AttachDir:    *attachDir,
+		Json:         *jsonOutput,
+		MaxResponse:  *maxResponse,
+		Signal:       *signal,
+		Format:       *format,
+		PollInterval: *pollInterval,
+		Quiet:        *quiet,
+		Force:        *force,
 	}, nil
 }
 
 // JattachValidate validates the JattachOption fields.
 func (opt *JattachOption) JattachValidate() error {
 	if opt.AgentPath == "" {
-		return fmt.Errorf("agentpath is required")
+		return ErrAgentPathRequired
 	}
-	if opt.User == "" {
-		currentUser, err := user.Current()
+	// the agent argument is NUL-terminated on the wire; newlines are passed through intact
+	if strings.ContainsRune(opt.AgentPath+opt.AgentParams, 0) {
+		return fmt.Errorf("agentpath and agentparams must not contain NUL bytes")
+	}
+	if _, _, err := parseTriggerSignal(opt.Signal); err != nil {
+		return err
+	}
+	if opt.PollInterval < 0 {
+		return fmt.Errorf("poll-interval must not be negative")
+	}
+	if opt.Format != "" {
+		if opt.Json {
+			return fmt.Errorf("json and format are mutually exclusive")
+		}
+		if _, err := template.New("format").Parse(opt.Format); err != nil {
+			return fmt.Errorf("invalid format: %v", err)
+		}
+	}
+	// checked for remote attaches too; the bridge checks the path again against its own allowlist
+	if err := checkAgentDir(opt.AgentPath); err != nil {
+		return err
+	}
+	if opt.Remote != "" {
+		// the bridge on the remote host validates the target process
+		if opt.Token == "" {
+			return fmt.Errorf("token is required for remote attach")
+		}
+		return nil
+	}
+	if opt.Port != 0 {
+		if opt.Pid != "" || opt.Class != "" {
+			return fmt.Errorf("port is mutually exclusive with pid and class")
+		}
+		pid, err := findPidByPort(opt.Port)
+		if err != nil {
+			return err
+		}
+		opt.Pid = pid
+	}
+	if opt.Class != "" {
+		if opt.Pid != "" {
+			return fmt.Errorf("pid and class are mutually exclusive")
+		}
+		username, err := resolveUser(opt.User)
 		if err != nil {
 			return err
 		}
-		opt.User = currentUser.Username
-	} else {
-		_, err := user.Lookup(opt.User)
+		pid, err := findPidByClass(username, opt.Class)
 		if err != nil {
 			return err
 		}
+		opt.Pid = pid
 	}
-	if opt.Pid == "" {
-		return fmt.Errorf("pid is required")
+	username, err := validateAttachTarget(opt.User, opt.Pid, opt.Force)
+	if err != nil {
+		return err
 	}
+	opt.User = username
+	return nil
+}
 
-	_, err := process.NewProcess(toInt32(opt.Pid))
+// validateAttachTarget runs validateTarget and the checks specific to attaching an agent:
+// pid is not jvmtool itself or its parent, unless force, and a cross-user attach runs as root.
+func validateAttachTarget(username string, pid string, force bool) (string, error) {
+	username, err := validateTarget(username, pid)
 	if err != nil {
-		return fmt.Errorf("process not found")
+		return "", err
 	}
-	pidFile := os.TempDir() + "/hsperfdata_" + opt.User + "/" + fmt.Sprint(opt.Pid)
-	if !pkg.PathExists(pidFile) {
-		return fmt.Errorf("pid does not belong to the specified user")
+	// a wrapper script passing its own or jvmtool's pid would make the JVM launcher attach to itself
+	if pid := toInt32(pid); !force && (pid == int32(os.Getpid()) || pid == int32(os.Getppid())) {
+		return "", ErrAttachSelf
 	}
-	return nil
+	if err := checkCrossUserAttach(username); err != nil {
+		return "", err
+	}
+	return username, nil
+}
+
+// allowedAgentDirsEnv lists the colon-separated directories agents may be loaded from.
+const allowedAgentDirsEnv = "JVMTOOL_ALLOWED_AGENT_DIRS"
+
+// checkAgentDir rejects agentPath if allowed agent directories are configured and the
+// path, after resolving symlinks, is not located under one of them.
+func checkAgentDir(agentPath string) error {
+	dirs := os.Getenv(allowedAgentDirsEnv)
+	if dirs == "" {
+		return nil
+	}
+	resolved, err := resolvePath(agentPath)
+	if err != nil {
+		return fmt.Errorf("cannot resolve agent path: %v", err)
+	}
+	for _, dir := range filepath.SplitList(dirs) {
+		if dir == "" {
+			continue
+		}
+		resolvedDir, err := resolvePath(dir)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(resolvedDir, resolved)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil
+		}
+	}
+	return ErrAgentPathNotAllowed
+}
+
+// resolvePath returns the absolute path with all symlinks resolved.
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+// validateTarget checks that pid is a running Java process owned by username,
+// defaulting username to the current user. It returns the resolved username.
+func validateTarget(username string, pid string) (string, error) {
+	username, err := resolveUser(username)
+	if err != nil {
+		return "", err
+	}
+	if pid == "" {
+		return "", ErrPidRequired
+	}
+
+	p, err := process.NewProcess(toInt32(pid))
+	if err != nil {
+		return "", ErrProcessNotFound
+	}
+	if !pkg.PathExists(GetHsperfdataPath(username, pid)) && !ownedByUID(username, pid) {
+		return "", ErrPidNotOwned
+	}
+	// fail fast instead of waiting for checkSocket to time out
+	if cmdSlice, err := p.CmdlineSlice(); err == nil && attachDisabled(cmdSlice) {
+		return "", ErrAttachDisabled
+	}
+	return username, nil
+}
+
+// ProcessUIDProvider returns the effective uid of a running process.
+// It is a variable so that tests can replace it.
+var ProcessUIDProvider = func(pid int32) (string, error) {
+	p, err := process.NewProcess(pid)
+	if err != nil {
+		return "", err
+	}
+	uids, err := p.Uids()
+	if err != nil {
+		return "", err
+	}
+	if len(uids) < 2 {
+		return "", fmt.Errorf("no effective uid for pid %d", pid)
+	}
+	return strconv.Itoa(int(uids[1])), nil
+}
+
+// ownedByUID reports whether pid runs as the uid of username and has an hsperfdata file under
+// any user's directory. The JVM names its hsperfdata directory after the name it resolves for
+// its uid, which can differ from username, e.g. for a login name aliasing the same uid.
+func ownedByUID(username string, pid string) bool {
+	u, err := user.Lookup(username)
+	if err != nil {
+		return false
+	}
+	if uid, err := ProcessUIDProvider(toInt32(pid)); err != nil || uid != u.Uid {
+		return false
+	}
+	return hasHsperfdata(pid)
+}
+
+// attachDisabled reports whether the JVM command line enables -XX:+DisableAttachMechanism.
+// The last occurrence of the flag wins, as in HotSpot.
+func attachDisabled(cmdSlice []string) bool {
+	_, vmArgs, _ := splitVmCmd(cmdSlice, JpsOption{ShowVMArgs: true})
+	disabled := false
+	for _, f := range parseXXFlags(vmArgs) {
+		if f.Name == "DisableAttachMechanism" {
+			disabled = f.Value == "true"
+		}
+	}
+	return disabled
+}
+
+// resolveUser checks that username exists, defaulting to the current user when empty.
+func resolveUser(username string) (string, error) {
+	if username == "" {
+		currentUser, err := user.Current()
+		if err != nil {
+			return "", err
+		}
+		return currentUser.Username, nil
+	}
+	if _, err := user.Lookup(username); err != nil {
+		return "", &userLookupError{err: err}
+	}
+	return username, nil
+}
+
+// findPidByClass returns the pid of the only Java process of username whose main class or jar is class.
+func findPidByClass(username string, class string) (string, error) {
+	pids, err := DiscoverJavaProcesses(username)
+	if err != nil {
+		return "", err
+	}
+	return matchPidByClass(collectProcessInfo(pids, JpsOption{User: username}), class)
+}
+
+// matchPidByClass picks the single process whose main class or jar is class,
+// listing the candidates when the match is ambiguous.
+func matchPidByClass(processes []JvmProcess, class string) (string, error) {
+	var matched []JvmProcess
+	for _, p := range processes {
+		if p.mainClassOrJar == class {
+			matched = append(matched, p)
+		}
+	}
+	switch len(matched) {
+	case 0:
+		return "", fmt.Errorf("no java process with main class %s", class)
+	case 1:
+		return fmt.Sprint(matched[0].Pid), nil
+	}
+	candidates := make([]string, 0, len(matched))
+	for _, p := range matched {
+		candidates = append(candidates, fmt.Sprint(p.Pid))
+	}
+	return "", fmt.Errorf("multiple java processes with main class %s: %s", class, strings.Join(candidates, ", "))
 }
 
 // toInt32 converts a string to int32, returns 0 if conversion fails.
@@ -74,23 +332,119 @@ func toInt32(s string) int32 {
 	return int32(n)
 }
 
+// jattachTemplateData is the outcome of a jattach as seen by a -format template.
+type jattachTemplateData struct {
+	Pid          int32
+	AgentPath    string
+	Success      bool
+	ResponseCode string
+	Message      string // the error on failure, the agent's output on success
+}
+
+// printJattachTemplate prints the outcome of a jattach with the -format template.
+// A template that fails validation is reported as is, since there is no outcome to format.
+func printJattachTemplate(o *output, option JattachOption, result LoadResult, err error) error {
+	tmpl, parseErr := template.New("format").Parse(option.Format)
+	if parseErr != nil {
+		return err
+	}
+	data := jattachTemplateData{
+		Pid:          toInt32(option.Pid),
+		AgentPath:    option.AgentPath,
+		Success:      err == nil,
+		ResponseCode: result.Code,
+		Message:      result.Body,
+	}
+	if err != nil {
+		data.Message = err.Error()
+	}
+	var sb strings.Builder
+	if execErr := tmpl.Execute(&sb, data); execErr != nil {
+		return fmt.Errorf("cannot format result: %v", execErr)
+	}
+	o.print(sb.String())
+	return nil
+}
+
+// JattachResult is the outcome of a jattach, printed with -json.
+type JattachResult struct {
+	Pid     int32  `json:"pid"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	LoadResult
+}
+
 // Jattach performs the attach operation to a Java process specified by the JattachOption.
+// Progress messages are suppressed with -quiet, -json and -format, leaving only the result.
 func Jattach(option JattachOption) int {
-	if err := option.JattachValidate(); err != nil {
-		log(err.Error())
+	o := newOutput(option.Out, option.ErrOut)
+	if option.Quiet || option.Json || option.Format != "" {
+		defer setLogQuiet(true)()
+	}
+	loadResult, err := jattach(o, &option)
+	if option.Format != "" {
+		if formatErr := printJattachTemplate(o, option, loadResult, err); formatErr != nil {
+			o.printError(formatErr)
+			return 1
+		}
+	} else if option.Json {
+		result := JattachResult{Pid: toInt32(option.Pid), Success: err == nil, LoadResult: loadResult}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		data, _ := json.Marshal(result)
+		o.print(string(data))
+	} else if err != nil {
+		o.printError(err)
+	}
+	if err != nil {
 		return 1
 	}
+	return 0
+}
+
+// printAttachPaths prints the .java_pid socket and .attach_pid trigger file paths of the target.
+// For a remote attach they are resolved by the bridge on its own host, which is printed instead.
+func printAttachPaths(o *output, option *JattachOption) {
+	if option.Remote != "" {
+		o.print(fmt.Sprintf("socket and attach file paths are resolved on the bridge host %s", option.Remote))
+		return
+	}
+	if toInt32(option.Pid) <= 0 {
+		o.print("socket and attach file paths are unknown without a valid pid")
+		return
+	}
+	jp := &JvmProcess{Pid: toInt32(option.Pid), SocketDir: option.SocketDir, AttachFileDir: option.AttachDir}
+	o.print("socket path: " + jp.socketPath())
+	o.print("attach file path: " + jp.attachFilePath())
+}
 
-	jp := &JvmProcess{
-		Pid: toInt32(option.Pid),
+// jattach validates the option and loads the agent, returning the decoded load response.
+func jattach(o *output, option *JattachOption) (LoadResult, error) {
+	err := option.JattachValidate()
+	// printed whether or not validation passes, as the paths help to diagnose a refused target
+	if option.PrintPaths {
+		printAttachPaths(o, option)
+	}
+	if err != nil {
+		return LoadResult{}, err
 	}
 
+	jp := &JvmProcess{
+		Pid:             toInt32(option.Pid),
+		ProtocolVersion: option.Protocol,
+		SocketDir:       option.SocketDir,
+		AttachFileDir:   option.AttachDir,
+		MaxResponseSize: option.MaxResponse,
+		TriggerSignal:   option.Signal,
+		PollInterval:    option.PollInterval,
+	}
+	if option.Remote != "" {
+		jp.connect = dialBridge(option.Remote, option.Token)
+		return jp.loadAgentResult(option.AgentPath, option.AgentParams)
+	}
 	if err := jp.checkSocket(); err != nil {
-		log(err.Error())
-		return 1
-	} else if err := jp.loadAgent(option.AgentPath, option.AgentParams); err != nil {
-		log(err.Error())
-		return 1
+		return LoadResult{}, err
 	}
-	return 0
+	return jp.loadAgentResult(option.AgentPath, option.AgentParams)
 }
@@ -1,9 +1,13 @@
 package internal
 
 import (
+	"bytes"
+	"errors"
 	"os"
 	"os/user"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -41,7 +45,7 @@ func TestJattachValidate(t *testing.T) {
 	tests := []struct {
 		name     string
 		option   JattachOption
-		expected string
+		expected error
 	}{
 		{
 			name: "pid err",
@@ -50,7 +54,7 @@ func TestJattachValidate(t *testing.T) {
 				Pid:       strconv.Itoa(pid),
 				AgentPath: "/tmp/agent.jar",
 			},
-			expected: "pid does not belong to the specified user",
+			expected: ErrPidNotOwned,
 		},
 		{
 			name: "missing pid",
@@ -59,7 +63,7 @@ func TestJattachValidate(t *testing.T) {
 				Pid:       "",
 				AgentPath: "/tmp/agent.jar",
 			},
-			expected: "pid is required",
+			expected: ErrPidRequired,
 		},
 		{
 			name: "missing agentpath",
@@ -68,18 +72,276 @@ func TestJattachValidate(t *testing.T) {
 				Pid:       "12345",
 				AgentPath: "",
 			},
-			expected: "agentpath is required",
+			expected: ErrAgentPathRequired,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			err := tt.option.JattachValidate()
-			if tt.expected == "" && err != nil {
+			if tt.expected == nil && err != nil {
 				t.Errorf("expected no error, got: %v", err)
-			} else if tt.expected != "" && (err == nil || err.Error() != tt.expected) {
-				t.Errorf("expected error '%s', got: %v", tt.expected, err)
+			} else if tt.expected != nil && !errors.Is(err, tt.expected) {
+				t.Errorf("expected error '%v', got: %v", tt.expected, err)
 			}
 		})
 	}
 }
+
+// TestJattachValidate_RemoteAllowedDirs tests that the allowed agent directories also apply to remote attaches.
+func TestJattachValidate_RemoteAllowedDirs(t *testing.T) {
+	agentPath := filepath.Join(t.TempDir(), "agent.jar")
+	if err := os.WriteFile(agentPath, nil, 0644); err != nil {
+		t.Fatalf("failed to create agent: %v", err)
+	}
+	t.Setenv(allowedAgentDirsEnv, t.TempDir())
+	opt := JattachOption{AgentPath: agentPath, Remote: "host:7000", Token: "secret"}
+	if err := opt.JattachValidate(); !errors.Is(err, ErrAgentPathNotAllowed) {
+		t.Errorf("expected ErrAgentPathNotAllowed, got: %v", err)
+	}
+	t.Setenv(allowedAgentDirsEnv, filepath.Dir(agentPath))
+	if err := opt.JattachValidate(); err != nil {
+		t.Errorf("expected no error, got: %v", err)
+	}
+}
+
+// TestJattachValidate_Remote tests that remote attach requires a token but no local pid.
+func TestJattachValidate_Remote(t *testing.T) {
+	opt := JattachOption{AgentPath: "/tmp/agent.jar", Remote: "host:7000"}
+	if err := opt.JattachValidate(); err == nil || err.Error() != "token is required for remote attach" {
+		t.Errorf("expected token error, got: %v", err)
+	}
+	opt.Token = "secret"
+	if err := opt.JattachValidate(); err != nil {
+		t.Errorf("expected no error, got: %v", err)
+	}
+
+	opt.AgentParams = "a=1\nb=2"
+	if err := opt.JattachValidate(); err != nil {
+		t.Errorf("expected multi-line params to be accepted, got: %v", err)
+	}
+	opt.AgentParams = "a=1\x00b=2"
+	if err := opt.JattachValidate(); err == nil {
+		t.Errorf("expected error for params containing NUL")
+	}
+
+	opt.AgentParams = ""
+	opt.Signal = "TERM"
+	if err := opt.JattachValidate(); err == nil {
+		t.Errorf("expected error for an unsupported trigger signal")
+	}
+}
+
+// TestCheckAgentDir tests the JVMTOOL_ALLOWED_AGENT_DIRS allowlist, including symlink escapes.
+func TestCheckAgentDir(t *testing.T) {
+	allowed := t.TempDir()
+	other := t.TempDir()
+	inside := filepath.Join(allowed, "agent.jar")
+	outside := filepath.Join(other, "agent.jar")
+	link := filepath.Join(allowed, "link.jar")
+	for _, f := range []string{inside, outside} {
+		if err := os.WriteFile(f, nil, 0644); err != nil {
+			t.Fatalf("failed to create agent file: %v", err)
+		}
+	}
+	if err := os.Symlink(outside, link); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	t.Setenv(allowedAgentDirsEnv, "")
+	if err := checkAgentDir(outside); err != nil {
+		t.Errorf("expected no restriction when unset, got: %v", err)
+	}
+
+	t.Setenv(allowedAgentDirsEnv, "/nonexistent:"+allowed)
+	if err := checkAgentDir(inside); err != nil {
+		t.Errorf("expected agent inside allowed dir to pass, got: %v", err)
+	}
+	for _, p := range []string{outside, link} {
+		if err := checkAgentDir(p); !errors.Is(err, ErrAgentPathNotAllowed) {
+			t.Errorf("expected %s to be rejected, got: %v", p, err)
+		}
+	}
+}
+
+// TestMatchPidByClass tests resolving a pid from a main class with zero, one and multiple matches.
+func TestMatchPidByClass(t *testing.T) {
+	processes := []JvmProcess{
+		{Pid: 100, mainClassOrJar: "com.example.App"},
+		{Pid: 200, mainClassOrJar: "com.example.Worker"},
+		{Pid: 300, mainClassOrJar: "com.example.Worker"},
+	}
+	if pid, err := matchPidByClass(processes, "com.example.App"); err != nil || pid != "100" {
+		t.Errorf("expected pid 100, got %s, %v", pid, err)
+	}
+	if _, err := matchPidByClass(processes, "com.example.Missing"); err == nil || err.Error() != "no java process with main class com.example.Missing" {
+		t.Errorf("expected no match error, got: %v", err)
+	}
+	if _, err := matchPidByClass(processes, "com.example.Worker"); err == nil || err.Error() != "multiple java processes with main class com.example.Worker: 200, 300" {
+		t.Errorf("expected ambiguous match error, got: %v", err)
+	}
+}
+
+// TestResolveUser_Unknown tests that an unknown user keeps the lookup error message and matches ErrUserNotFound.
+func TestResolveUser_Unknown(t *testing.T) {
+	_, err := resolveUser("nonexistentuser_jvmtool")
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound, got: %v", err)
+	}
+	var unknown user.UnknownUserError
+	if !errors.As(err, &unknown) || err.Error() != unknown.Error() {
+		t.Errorf("expected the user.UnknownUserError message, got: %v", err)
+	}
+}
+
+// TestJattachValidate_PortExclusive tests that -port cannot be combined with -pid or -class.
+func TestJattachValidate_PortExclusive(t *testing.T) {
+	for _, opt := range []JattachOption{
+		{Port: 8080, Pid: "12345", AgentPath: "/tmp/agent.jar"},
+		{Port: 8080, Class: "com.example.App", AgentPath: "/tmp/agent.jar"},
+	} {
+		if err := opt.JattachValidate(); err == nil || err.Error() != "port is mutually exclusive with pid and class" {
+			t.Errorf("expected mutual exclusion error, got: %v", err)
+		}
+	}
+}
+
+// TestAttachDisabled tests detection of -XX:+DisableAttachMechanism on the JVM command line.
+func TestAttachDisabled(t *testing.T) {
+	tests := []struct {
+		cmd      []string
+		expected bool
+	}{
+		{[]string{"java", "-Xmx1g", "com.example.App"}, false},
+		{[]string{"java", "-XX:+DisableAttachMechanism", "com.example.App"}, true},
+		{[]string{"java", "-XX:+DisableAttachMechanism", "-XX:-DisableAttachMechanism", "com.example.App"}, false},
+		{[]string{"java", "com.example.App", "-XX:+DisableAttachMechanism"}, false},
+	}
+	for _, tt := range tests {
+		if got := attachDisabled(tt.cmd); got != tt.expected {
+			t.Errorf("attachDisabled(%v) = %v, expected %v", tt.cmd, got, tt.expected)
+		}
+	}
+}
+
+// TestJattach_JsonError tests that failures are reported as a JSON result with -json.
+func TestJattach_JsonError(t *testing.T) {
+	var out bytes.Buffer
+	code := Jattach(JattachOption{Pid: "12345", Json: true, Out: &out})
+	if code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+	logs := outputLines(&out)
+	if len(logs) != 1 || logs[0] != `{"pid":12345,"success":false,"error":"agentpath is required"}` {
+		t.Errorf("unexpected JSON output: %v", logs)
+	}
+}
+
+// TestJattach_PrintPaths tests that -print-paths prints the paths even when the target is refused.
+func TestJattach_PrintPaths(t *testing.T) {
+	var out, errOut bytes.Buffer
+	dir := t.TempDir()
+	code := Jattach(JattachOption{Pid: "999999", AgentPath: "/tmp/agent.jar", PrintPaths: true, SocketDir: dir, AttachDir: dir, Out: &out, ErrOut: &errOut})
+	if code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+	expected := []string{"socket path: " + dir + "/.java_pid999999", "attach file path: " + dir + "/.attach_pid999999"}
+	if lines := outputLines(&out); strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected %v, got %v", expected, lines)
+	}
+	if errOut.Len() == 0 {
+		t.Errorf("expected the validation error")
+	}
+
+	out.Reset()
+	o := newOutput(&out, nil)
+	printAttachPaths(o, &JattachOption{Remote: "host:7000"})
+	printAttachPaths(o, &JattachOption{Pid: "abc"})
+	expected = []string{
+		"socket and attach file paths are resolved on the bridge host host:7000",
+		"socket and attach file paths are unknown without a valid pid",
+	}
+	if lines := outputLines(&out); strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected %v, got %v", expected, lines)
+	}
+}
+
+// TestPrintJattachTemplate tests -format output for successful and failed attaches.
+func TestPrintJattachTemplate(t *testing.T) {
+	var out bytes.Buffer
+	o := newOutput(&out, nil)
+	option := JattachOption{Pid: "12345", AgentPath: "/tmp/agent.jar", Format: "{{.Pid}} {{.AgentPath}} ok={{.Success}} code={{.ResponseCode}} {{.Message}}"}
+	if err := printJattachTemplate(o, option, LoadResult{Code: "0", Body: "started"}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if logs := outputLines(&out); len(logs) != 1 || logs[0] != "12345 /tmp/agent.jar ok=true code=0 started" {
+		t.Errorf("unexpected output: %v", logs)
+	}
+
+	out.Reset()
+	if err := printJattachTemplate(o, option, LoadResult{Code: "100"}, ErrAgentClassMissing); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if logs := outputLines(&out); len(logs) != 1 || logs[0] != "12345 /tmp/agent.jar ok=false code=100 "+ErrAgentClassMissing.Error() {
+		t.Errorf("unexpected output: %v", logs)
+	}
+
+	opt := JattachOption{AgentPath: "/tmp/agent.jar", Remote: "host:7000", Token: "secret", Format: "{{.Pid"}
+	if err := opt.JattachValidate(); err == nil {
+		t.Errorf("expected error for an invalid template")
+	}
+	opt = JattachOption{AgentPath: "/tmp/agent.jar", Remote: "host:7000", Token: "secret", Format: "{{.Pid}}", Json: true}
+	if err := opt.JattachValidate(); err == nil {
+		t.Errorf("expected error for -format with -json")
+	}
+}
+
+// TestValidateTarget_UIDMatch tests that a JVM whose hsperfdata directory is named after another
+// name for the same uid is accepted, while a process of another uid is still rejected.
+func TestValidateTarget_UIDMatch(t *testing.T) {
+	u, _ := user.Current()
+	pid := os.Getpid()
+	t.Setenv("TMPDIR", t.TempDir())
+	_, cleanup, err := prepareHsperfdataFile("login-alias", pid)
+	if err != nil {
+		t.Fatalf("failed to create hsperfdata file: %v", err)
+	}
+	defer cleanup()
+
+	origProvider := ProcessUIDProvider
+	defer func() { ProcessUIDProvider = origProvider }()
+
+	ProcessUIDProvider = func(int32) (string, error) { return u.Uid, nil }
+	username, err := validateTarget(u.Username, strconv.Itoa(pid))
+	if err != nil {
+		t.Fatalf("expected a uid match to be accepted, got: %v", err)
+	}
+	if username != u.Username {
+		t.Errorf("expected username %s, got %s", u.Username, username)
+	}
+
+	ProcessUIDProvider = func(int32) (string, error) { return u.Uid + "0", nil }
+	if _, err := validateTarget(u.Username, strconv.Itoa(pid)); !errors.Is(err, ErrPidNotOwned) {
+		t.Errorf("expected ErrPidNotOwned for a uid mismatch, got: %v", err)
+	}
+}
+
+// TestJattachValidate_Self tests that jvmtool refuses to attach to itself unless forced.
+func TestJattachValidate_Self(t *testing.T) {
+	u, _ := user.Current()
+	t.Setenv("TMPDIR", t.TempDir())
+	_, cleanup, err := prepareHsperfdataFile(u.Username, os.Getpid())
+	if err != nil {
+		t.Fatalf("failed to create hsperfdata file: %v", err)
+	}
+	defer cleanup()
+
+	option := JattachOption{Pid: strconv.Itoa(os.Getpid()), AgentPath: "/tmp/agent.jar", Signal: "QUIT"}
+	if err := option.JattachValidate(); !errors.Is(err, ErrAttachSelf) {
+		t.Errorf("expected ErrAttachSelf, got: %v", err)
+	}
+	option.Force = true
+	if err := option.JattachValidate(); err != nil {
+		t.Errorf("expected no error with -force, got: %v", err)
+	}
+}
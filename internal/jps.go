@@ -1,14 +1,22 @@
 package internal
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"math"
 	"os"
 	"os/user"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/XHao/jvmtool/pkg"
 	"github.com/shirou/gopsutil/process"
@@ -22,33 +30,115 @@ func ParseJpsFlags(args []string) (JpsOption, error) {
 	showVMArgs := jpsFlagSet.Bool("v", false, "show JVM arguments")
 	showArgs := jpsFlagSet.Bool("m", false, "show main method arguments")
 	quiet := jpsFlagSet.Bool("q", false, "only show process id")
+	groupByClass := jpsFlagSet.Bool("group-by-class", false, "print process counts grouped by main class")
+	showXXFlags := jpsFlagSet.Bool("xx", false, "show -XX flags as name/value pairs")
+	users := jpsFlagSet.String("users", "", "specify a comma-separated list of users to list Java processes for")
+	strict := jpsFlagSet.Bool("strict", false, "fail if any of -users has no Java process")
+	jsonOutput := jpsFlagSet.Bool("json", false, "print the Java processes as a JSON array")
+	groupByUser := jpsFlagSet.Bool("group-by-user", false, "print the Java processes grouped under a header per user")
+	showCPU := jpsFlagSet.Bool("cpu", false, "show CPU utilization sampled over -cpu-interval")
+	cpuInterval := jpsFlagSet.Duration("cpu-interval", 500*time.Millisecond, "specify the CPU sampling interval")
+	output := jpsFlagSet.String("o", "", "write the output to a file, replaced atomically once complete")
+	redact := jpsFlagSet.Bool("redact", false, "mask the values of -D system properties whose key matches -redact-keys")
+	redactKeys := jpsFlagSet.String("redact-keys", defaultRedactKeys, "specify the comma-separated key substrings masked by -redact")
+	showHeap := jpsFlagSet.Bool("heap", false, "show -Xms/-Xmx/-Xss/-Xmn sizes in bytes")
+	showContainer := jpsFlagSet.Bool("container", false, "show the cgroup memory limit in bytes")
+	showClasses := jpsFlagSet.Bool("classes", false, "show the number of live loaded classes")
+	warnClasses := jpsFlagSet.Int64("warn-classes", 0, "flag Java processes with more live loaded classes than this, implies -classes")
+	showActivity := jpsFlagSet.Bool("activity", false, "show when the JVM last updated its hsperfdata file")
+	concurrency := jpsFlagSet.Int("concurrency", defaultConcurrency, "specify how many Java processes are inspected at once")
+	sockets := jpsFlagSet.Bool("sockets", false, "also discover Java processes by their attach socket")
+	max := jpsFlagSet.Int("max", 0, "specify the maximum number of Java processes to inspect, 0 for unlimited")
+	strictParse := jpsFlagSet.Bool("strict-parse", false, "only accept a main class after a classpath or module option")
 	if err := jpsFlagSet.Parse(args); err != nil {
 		return JpsOption{}, err
 	}
 	return JpsOption{
-		User:       *user,
-		ShowLong:   *showLong,
-		ShowVMArgs: *showVMArgs,
-		ShowArgs:   *showArgs,
-		Quiet:      *quiet,
+		User:          *user,
+		Users:         splitList(*users),
+		Strict:        *strict,
+		Json:          *jsonOutput,
+		GroupByUser:   *groupByUser,
+		ShowCPU:       *showCPU,
+		CPUInterval:   *cpuInterval,
+		Concurrency:   *concurrency,
+		Max:           *max,
+		Sockets:       *sockets,
+		ShowActivity:  *showActivity,
+		ShowClasses:   *showClasses || *warnClasses > 0,
+		WarnClasses:   *warnClasses,
+		Output:        *output,
+		ShowHeap:      *showHeap,
+		ShowContainer: *showContainer,
+		Redact:        *redact,
+		RedactKeys:    splitList(*redactKeys),
+		ShowLong:      *showLong,
+		ShowVMArgs:    *showVMArgs,
+		ShowArgs:      *showArgs,
+		Quiet:         *quiet,
+		GroupByClass:  *groupByClass,
+		ShowXXFlags:   *showXXFlags,
+		StrictParse:   *strictParse,
 	}, nil
 }
 
 type JpsOption struct {
-	User       string
-	ShowLong   bool // -l
-	ShowVMArgs bool // -v
-	ShowArgs   bool // -m
-	Quiet      bool // -q
+	User          string
+	Users         []string      // -users
+	Strict        bool          // -strict
+	Json          bool          // -json
+	GroupByUser   bool          // -group-by-user
+	ShowCPU       bool          // -cpu
+	CPUInterval   time.Duration // -cpu-interval
+	Concurrency   int           // -concurrency
+	Max           int           // -max
+	Sockets       bool          // -sockets
+	ShowActivity  bool          // -activity
+	ShowClasses   bool          // -classes
+	WarnClasses   int64         // -warn-classes
+	Output        string        // -o
+	ShowHeap      bool          // -heap
+	ShowContainer bool          // -container
+	Redact        bool          // -redact
+	RedactKeys    []string      // -redact-keys
+	ShowLong      bool          // -l
+	ShowVMArgs    bool          // -v
+	ShowArgs      bool          // -m
+	Quiet         bool          // -q
+	GroupByClass  bool          // -group-by-class
+	ShowXXFlags   bool          // -xx
+	StrictParse   bool          // -strict-parse
+	Out           io.Writer     // results, os.Stdout if nil
+	ErrOut        io.Writer     // errors, os.Stderr if nil
 }
 
 // JpsValidate checks if the JpsOption fields are valid.
-// Currently, it validates the User field if provided.
+// Currently, it validates the User or Users fields if provided.
 func (opt *JpsOption) JpsValidate() error {
+	if opt.Max < 0 {
+		return errors.New("max must not be negative")
+	}
+	if len(opt.Users) > 0 {
+		if opt.User != "" {
+			return errors.New("user and users are mutually exclusive")
+		}
+		for _, u := range opt.Users {
+			if _, err := user.Lookup(u); err != nil {
+				return fmt.Errorf("%w: %s", ErrUserNotFound, u)
+			}
+		}
+		return nil
+	}
+	if opt.Strict {
+		return errors.New("strict requires users")
+	}
+	if opt.GroupByUser {
+		return errors.New("group-by-user requires users")
+	}
 	if opt.User != "" {
 		_, err := user.Lookup(opt.User)
 		if err != nil {
-			return errors.New("user does not exist")
+			return ErrUserNotFound
 		}
 	} else {
 		if current, err := user.Current(); err != nil {
@@ -61,65 +151,480 @@ func (opt *JpsOption) JpsValidate() error {
 }
 
 // JpsList returns a list of Java process information for the current or specified user.
+// With -o the whole output is buffered and written to the file in one atomic replace;
+// on failure nothing is written and the output goes to option.Out instead.
 // @see sun.jvmstat.perfdata.monitor.protocol.local.LocalVmManager.activeVms()
 func JpsList(option JpsOption) int {
+	o := newOutput(option.Out, option.ErrOut)
+	if option.Output == "" {
+		return jpsList(o, option)
+	}
+	var buf bytes.Buffer
+	code := jpsList(&output{out: &buf, errOut: o.errOut}, option)
+	if code != 0 {
+		o.out.Write(buf.Bytes())
+		return code
+	}
+	if err := writeFileAtomic(option.Output, buf.Bytes()); err != nil {
+		o.printError(err)
+		return 1
+	}
+	return 0
+}
+
+// jpsList prints the Java processes selected by option.
+func jpsList(o *output, option JpsOption) int {
 	if err := option.JpsValidate(); err != nil {
-		log(err.Error())
+		o.printError(err)
 		return 1
 	}
 
+	users := option.Users
+	if len(users) == 0 {
+		users = []string{option.User}
+	}
+	if option.Json {
+		// JSON output always carries the VM and main arguments
+		option.ShowVMArgs = true
+		option.ShowArgs = true
+	}
 	finded := []JvmProcess{}
-	tempDir := os.TempDir()
+	missing := false
+	discovered, inspected := 0, 0
+	for _, u := range users {
+		pids, err := DiscoverJavaProcesses(u)
+		if option.Sockets {
+			pids = mergePids(pids, discoverSocketPids(u))
+		}
+		if err != nil || len(pids) == 0 {
+			if option.Strict {
+				o.printError(fmt.Errorf("no java process for user %s", u))
+				missing = true
+			}
+			continue
+		}
+		discovered += len(pids)
+		if option.Max > 0 {
+			pids = capPids(pids, option.Max-inspected)
+			inspected += len(pids)
+		}
+		for _, p := range collectProcessInfo(pids, option) {
+			p.Username = u
+			if option.ShowActivity {
+				p.lastActivity = hsperfdataModTime(u, p.Pid)
+			}
+			if option.ShowClasses {
+				p.classes = hsperfdataLiveClasses(u, p.Pid)
+			}
+			finded = append(finded, p)
+		}
+	}
+	if missing {
+		return 1
+	}
+	if option.ShowCPU {
+		finded = sampleCPU(finded, option.CPUInterval)
+	}
+	// with -users the same pid can be listed under several owners, e.g. from different PID namespaces
+	pids := make([]int32, len(finded))
+	owners := make([]string, len(finded))
+	for i, p := range finded {
+		pids[i], owners[i] = p.Pid, p.Username
+	}
+	ambiguous := ambiguousPids(pids)
+	for i := range finded {
+		finded[i].ambiguous = ambiguous[finded[i].Pid]
+	}
+	if len(finded) == 0 {
+		o.printError(errors.New("no java process"))
+		return 1
+	}
 
-	namePatternPrefix := tempDir + "/hsperfdata_" + option.User + "/"
-	fileNamePattern := namePatternPrefix + "*"
-	pids := []int32{}
+	if option.GroupByClass {
+		printClassCounts(o, finded)
+	} else if option.Json {
+		data, err := json.Marshal(finded)
+		if err != nil {
+			o.printError(err)
+			return 1
+		}
+		o.print(string(data))
+		// keep the output a valid JSON document, the truncation warning is not printed
+		return 0
+	} else {
+		if option.GroupByUser {
+			printGroupedByUser(o, finded, option)
+		} else {
+			for _, p := range finded {
+				printJps(o, p, option)
+			}
+		}
+		if option.ShowXXFlags {
+			printXXFlags(o, finded)
+		}
+		warnAmbiguousPids(o, pids, owners)
+	}
+	if option.Max > 0 && discovered > inspected {
+		o.warn(fmt.Sprintf("list truncated by -max, inspected %d of %d java processes", inspected, discovered))
+	}
+	return 0
+}
 
-	files, err := filepath.Glob(fileNamePattern)
-	if err != nil || len(files) == 0 {
-		log("no java process")
-		return 1
+// capPids returns the lowest limit pids in ascending order, or none if limit is not positive.
+func capPids(pids []int32, limit int) []int32 {
+	if limit <= 0 {
+		return nil
 	}
-	for _, file := range files {
-		index := strings.LastIndex(file, "/") + 1
+	sorted := append([]int32(nil), pids...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	if len(sorted) > limit {
+		sorted = sorted[:limit]
+	}
+	return sorted
+}
+
+// printGroupedByUser prints processes under a "== <username> ==" header per owner.
+// processes must already be ordered by owner, and by pid within each owner.
+func printGroupedByUser(o *output, processes []JvmProcess, option JpsOption) {
+	for i, p := range processes {
+		if i == 0 || processes[i-1].Username != p.Username {
+			o.print(fmt.Sprintf("== %s ==", p.Username))
+		}
+		printJps(o, p, option)
+	}
+}
+
+// printClassCounts prints "<count> <mainClass>" lines sorted descending by count,
+// ties broken by main class name. A pid listed under several users is counted once.
+func printClassCounts(o *output, processes []JvmProcess) {
+	counts := map[string]int{}
+	seen := map[int32]bool{}
+	for _, p := range processes {
+		if seen[p.Pid] {
+			continue
+		}
+		seen[p.Pid] = true
+		counts[p.mainClassOrJar]++
+	}
+	classes := make([]string, 0, len(counts))
+	for class := range counts {
+		classes = append(classes, class)
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		if counts[classes[i]] != counts[classes[j]] {
+			return counts[classes[i]] > counts[classes[j]]
+		}
+		return classes[i] < classes[j]
+	})
+	for _, class := range classes {
+		o.print(fmt.Sprintf("%d %s", counts[class], class))
+	}
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
 
-		if pid, err := strconv.Atoi(file[index:]); err != nil {
+// DiscoverJavaProcesses returns the pids of live Java processes that have an hsperfdata file
+// under the given user's hsperfdata directory. If the resolved directory has none, the
+// alternate resolution of the temp dir is probed as well. The pids are in ascending numeric
+// order, not in the lexical order of the file names.
+func DiscoverJavaProcesses(username string) ([]int32, error) {
+	pids := []int32{}
+	for _, dir := range hsperfdataDirs(username) {
+		files, err := filepath.Glob(filepath.Join(dir, "*"))
+		if err != nil {
+			return nil, err
+		}
+		pids = appendLivePids(pids, files)
+		if len(pids) > 0 {
+			break
+		}
+	}
+	sort.Slice(pids, func(i, j int) bool { return pids[i] < pids[j] })
+	return pids, nil
+}
+
+// appendLivePids appends the pids named by hsperfdata files whose process is still alive.
+// Numeric files that are not hsperfdata files are skipped, so they are not listed as phantom JVMs.
+func appendLivePids(pids []int32, files []string) []int32 {
+	for _, file := range files {
+		if pid, err := strconv.Atoi(filepath.Base(file)); err != nil {
 			continue
 		} else if exist, _ := pkg.PidExists(int32(pid)); !exist {
 			continue
+		} else if !pkg.MaybePerfData(file) {
+			continue
 		} else {
 			pids = append(pids, int32(pid))
 		}
 	}
+	return pids
+}
 
-	if len(pids) == 0 {
-		log("no java process")
-		return 1
+// discoverSocketPids returns the pids of live processes owned by username that have an attach
+// socket in the temp dir. This finds JVMs run with -XX:-UsePerfData, which have no hsperfdata
+// file, once their attach listener was started.
+func discoverSocketPids(username string) []int32 {
+	files, err := filepath.Glob(filepath.Join(orTempDir(""), ".java_pid*"))
+	if err != nil {
+		return nil
 	}
+	pids := []int32{}
+	for _, file := range files {
+		pid, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(file), ".java_pid"))
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil || info.Mode()&os.ModeSocket == 0 || !fileOwnedBy(info, username) {
+			continue
+		}
+		if exist, _ := pkg.PidExists(int32(pid)); exist {
+			pids = append(pids, int32(pid))
+		}
+	}
+	return pids
+}
+
+// mergePids appends the pids of extra not in pids yet.
+func mergePids(pids []int32, extra []int32) []int32 {
+	seen := map[int32]bool{}
 	for _, pid := range pids {
-		p, err := process.NewProcess(pid)
+		seen[pid] = true
+	}
+	for _, pid := range extra {
+		if !seen[pid] {
+			seen[pid] = true
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+// ProcessProvider returns the command line of a running process, or an error if the process
+// is gone. It is a variable so that tests can replace it.
+var ProcessProvider = func(pid int32) ([]string, error) {
+	p, err := process.NewProcess(pid)
+	if err != nil {
+		return nil, err
+	}
+	return cmdlineOrFallback(pid, p.CmdlineSlice, fallbackCmdline), nil
+}
+
+// cmdlineOrFallback returns the command line read by cmdline, or by fallback if that fails.
+// If both fail the command line is empty, so the process is still listed.
+func cmdlineOrFallback(pid int32, cmdline func() ([]string, error), fallback func(int32) ([]string, error)) []string {
+	cmdSlice, err := cmdline()
+	if err != nil {
+		// hardened kernels and restricted sysctl can make gopsutil fail where
+		// /proc or the hsperfdata file is still readable
+		if fallbackSlice, fallbackErr := fallback(pid); fallbackErr == nil {
+			return fallbackSlice
+		}
+	}
+	return cmdSlice
+}
+
+// defaultConcurrency caps the number of JVMs touched at once by batch operations unless -concurrency is given.
+var defaultConcurrency = runtime.NumCPU()
+
+// concurrencyOrDefault returns n, or defaultConcurrency if n is not positive.
+func concurrencyOrDefault(n int) int {
+	if n <= 0 {
+		return defaultConcurrency
+	}
+	return n
+}
+
+// collectProcessInfo builds the JvmProcess entries for pids in parallel, at most option.Concurrency
+// at a time, skipping processes that have gone away. The result is sorted by pid.
+func collectProcessInfo(pids []int32, option JpsOption) []JvmProcess {
+	results := make([]*JvmProcess, len(pids))
+	sem := make(chan struct{}, concurrencyOrDefault(option.Concurrency))
+	var wg sync.WaitGroup
+	for i, pid := range pids {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, pid int32) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			cmdSlice, err := ProcessProvider(pid)
+			if err != nil {
+				return
+			}
+			if option.Redact {
+				cmdSlice = redactCmdline(cmdSlice, option.RedactKeys)
+			}
+			cmd := strings.Join(cmdSlice, " ")
+			mainClassOrJar, vmArgList, mainArgs := splitVmCmd(cmdSlice, option)
+			jp := JvmProcess{Pid: pid, Cmd: cmd, mainClassOrJar: mainClassOrJar, mainArgs: mainArgs}
+			if len(vmArgList) > 0 {
+				jp.vmArgs = strings.Join(vmArgList, " ") + " "
+			}
+			if option.ShowXXFlags {
+				jp.xxFlags = parseXXFlags(vmArgList)
+			}
+			if option.ShowHeap || option.Json {
+				jp.memory = parseMemorySizes(vmArgList)
+			}
+			if option.ShowContainer {
+				if limit := containerMemoryLimit(pid); limit > 0 {
+					if jp.memory == nil {
+						jp.memory = &MemorySizes{}
+					}
+					jp.memory.Container = limit
+				}
+			}
+			results[i] = &jp
+		}(i, pid)
+	}
+	wg.Wait()
+
+	finded := []JvmProcess{}
+	for _, jp := range results {
+		if jp != nil {
+			finded = append(finded, *jp)
+		}
+	}
+	sort.Slice(finded, func(i, j int) bool { return finded[i].Pid < finded[j].Pid })
+	return finded
+}
+
+// defaultRedactKeys are the key substrings of system properties that commonly hold secrets.
+const defaultRedactKeys = "password,secret,token,key"
+
+// redactedValue replaces the value of a redacted system property.
+const redactedValue = "***"
+
+// redactCmdline returns a copy of cmdSlice where the value of every -D<key>=<value> whose key
+// contains one of keys, case-insensitively, is masked. The -D options are masked wherever they
+// appear, so the redaction carries over to the command line, VM args and JSON output alike.
+func redactCmdline(cmdSlice []string, keys []string) []string {
+	redacted := make([]string, len(cmdSlice))
+	for i, arg := range cmdSlice {
+		redacted[i] = arg
+		property, ok := strings.CutPrefix(arg, "-D")
+		if !ok {
+			continue
+		}
+		key, _, ok := strings.Cut(property, "=")
+		if !ok {
+			continue
+		}
+		for _, k := range keys {
+			if k != "" && strings.Contains(strings.ToLower(key), strings.ToLower(k)) {
+				redacted[i] = "-D" + key + "=" + redactedValue
+				break
+			}
+		}
+	}
+	return redacted
+}
+
+// CPUTimeProvider returns the user plus system CPU seconds consumed by a process.
+// It is a variable so that tests can replace it.
+var CPUTimeProvider = func(pid int32) (float64, error) {
+	p, err := process.NewProcess(pid)
+	if err != nil {
+		return 0, err
+	}
+	times, err := p.Times()
+	if err != nil {
+		return 0, err
+	}
+	return times.User + times.System, nil
+}
+
+// sampleCPU measures the CPU utilization of all processes over one shared interval,
+// omitting processes that exit or cannot be sampled meanwhile.
+func sampleCPU(processes []JvmProcess, interval time.Duration) []JvmProcess {
+	before := make([]float64, len(processes))
+	sampled := make([]bool, len(processes))
+	for i, p := range processes {
+		if t, err := CPUTimeProvider(p.Pid); err == nil {
+			before[i] = t
+			sampled[i] = true
+		}
+	}
+	start := time.Now()
+	time.Sleep(interval)
+	elapsed := time.Since(start).Seconds()
+
+	result := []JvmProcess{}
+	for i, p := range processes {
+		if !sampled[i] {
+			continue
+		}
+		after, err := CPUTimeProvider(p.Pid)
 		if err != nil {
 			continue
 		}
-		cmdSlice, _ := p.CmdlineSlice()
-		cmd := strings.Join(cmdSlice, " ")
-		mainClassOrJar, vmArgs, mainArgs := analyzeVmCmd(cmdSlice, option)
-		finded = append(finded, JvmProcess{Pid: p.Pid, Cmd: cmd, mainClassOrJar: mainClassOrJar, vmArgs: vmArgs, mainArgs: mainArgs})
+		percent := (after - before[i]) / elapsed * 100
+		p.cpuPercent = &percent
+		result = append(result, p)
 	}
+	return result
+}
 
-	for _, p := range finded {
-		printJps(p, option)
+// hsperfdataModTime returns the mtime of the hsperfdata file of pid. The JVM touches it as it
+// updates its counters, so a stale mtime hints at a hung JVM or one with -XX:-UsePerfData.
+func hsperfdataModTime(username string, pid int32) *time.Time {
+	info, err := os.Stat(GetHsperfdataPath(username, fmt.Sprint(pid)))
+	if err != nil {
+		return nil
 	}
-	return 0
+	modTime := info.ModTime()
+	return &modTime
+}
+
+// hsperfdataLiveClasses returns the number of live loaded classes of pid, or nil if its
+// hsperfdata file cannot be read.
+func hsperfdataLiveClasses(username string, pid int32) *int64 {
+	perfData, err := pkg.ReadPerfData(GetHsperfdataPath(username, fmt.Sprint(pid)))
+	if err != nil {
+		return nil
+	}
+	classes, ok := liveClasses(perfData)
+	if !ok {
+		return nil
+	}
+	return &classes
+}
+
+// liveClasses returns the loaded minus the unloaded classes, including those of the CDS archive.
+// A steadily growing count hints at a class loader leak.
+func liveClasses(perfData *pkg.PerfData) (int64, bool) {
+	loaded, ok := perfData.Long("java.cls.loadedClasses")
+	if !ok {
+		return 0, false
+	}
+	unloaded, _ := perfData.Long("java.cls.unloadedClasses")
+	sharedLoaded, _ := perfData.Long("java.cls.sharedLoadedClasses")
+	sharedUnloaded, _ := perfData.Long("java.cls.sharedUnloadedClasses")
+	return loaded - unloaded + sharedLoaded - sharedUnloaded, true
 }
 
 // printJps prints the information of a Java process according to the JpsOption.
-func printJps(process JvmProcess, option JpsOption) {
+func printJps(o *output, process JvmProcess, option JpsOption) {
 	if option.Quiet {
-		log(fmt.Sprintf("%d", process.Pid))
+		o.print(fmt.Sprintf("%d", process.Pid))
 		return
 	}
 	output := fmt.Sprintf("%d", process.Pid)
+	if len(option.Users) > 0 && !option.GroupByUser {
+		output += fmt.Sprintf(" %s", process.Username)
+		if process.ambiguous {
+			output += "*"
+		}
+	}
 	if option.ShowLong {
 		output += fmt.Sprintf(" %s", process.Cmd)
 	} else {
@@ -131,14 +636,179 @@ func printJps(process JvmProcess, option JpsOption) {
 	if option.ShowArgs && process.mainArgs != "" {
 		output += fmt.Sprintf(" %s", process.mainArgs)
 	}
-	log(output)
+	if option.ShowCPU && process.cpuPercent != nil {
+		output += fmt.Sprintf(" %.1f%%", *process.cpuPercent)
+	}
+	if option.ShowHeap && process.memory != nil {
+		for _, size := range process.memory.columns() {
+			output += " " + size
+		}
+	}
+	if option.ShowContainer && process.memory != nil && process.memory.Container > 0 {
+		output += fmt.Sprintf(" container=%d", process.memory.Container)
+		if process.memory.Xmx > process.memory.Container {
+			output += " (xmx exceeds container)"
+		}
+	}
+	if option.ShowClasses && process.classes != nil {
+		output += fmt.Sprintf(" classes=%d", *process.classes)
+		if option.WarnClasses > 0 && *process.classes > option.WarnClasses {
+			output += fmt.Sprintf(" (classes exceed %d)", option.WarnClasses)
+		}
+	}
+	if option.ShowActivity && process.lastActivity != nil {
+		output += fmt.Sprintf(" updated %s ago", time.Since(*process.lastActivity).Round(time.Second))
+	}
+	o.print(output)
+}
+
+// printXXFlags prints the -XX flags of the processes as a block of "<pid> <name> <value>" lines
+// after a "== -XX flags ==" header, so that the process lines above stay one per process.
+func printXXFlags(o *output, processes []JvmProcess) {
+	header := false
+	for _, p := range processes {
+		for _, f := range p.xxFlags {
+			if !header {
+				o.print("== -XX flags ==")
+				header = true
+			}
+			o.print(fmt.Sprintf("%d %s %s", p.Pid, f.Name, f.Value))
+		}
+	}
+}
+
+// VMFlag is a parsed -XX option. Boolean flags (-XX:+Name / -XX:-Name) have the value "true" or "false".
+type VMFlag struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// parseXXFlags extracts the -XX: options from vmArgs into name/value pairs, in order of appearance.
+func parseXXFlags(vmArgs []string) []VMFlag {
+	var flags []VMFlag
+	for _, arg := range vmArgs {
+		opt, ok := strings.CutPrefix(arg, "-XX:")
+		if !ok || opt == "" {
+			continue
+		}
+		switch opt[0] {
+		case '+':
+			flags = append(flags, VMFlag{Name: opt[1:], Value: "true"})
+		case '-':
+			flags = append(flags, VMFlag{Name: opt[1:], Value: "false"})
+		default:
+			name, value, _ := strings.Cut(opt, "=")
+			flags = append(flags, VMFlag{Name: name, Value: value})
+		}
+	}
+	return flags
+}
+
+// MemorySizes holds the memory sizing flags of a JVM in bytes; absent flags are zero.
+// Container is the cgroup memory limit, set with -container if the JVM has one.
+type MemorySizes struct {
+	Xms       int64 `json:"xms,omitempty"`
+	Xmx       int64 `json:"xmx,omitempty"`
+	Xss       int64 `json:"xss,omitempty"`
+	Xmn       int64 `json:"xmn,omitempty"`
+	Container int64 `json:"container,omitempty"`
+}
+
+// columns returns "<flag>=<bytes>" for each flag present, in a fixed order. The container
+// limit is not a flag and is printed separately.
+func (m *MemorySizes) columns() []string {
+	var columns []string
+	for _, f := range []struct {
+		name  string
+		value int64
+	}{{"xms", m.Xms}, {"xmx", m.Xmx}, {"xss", m.Xss}, {"xmn", m.Xmn}} {
+		if f.value > 0 {
+			columns = append(columns, fmt.Sprintf("%s=%d", f.name, f.value))
+		}
+	}
+	return columns
+}
+
+// parseMemorySizes extracts -Xms, -Xmx, -Xss and -Xmn from vmArgs. As in HotSpot the last
+// occurrence wins. It returns nil if none is present or parseable.
+func parseMemorySizes(vmArgs []string) *MemorySizes {
+	var m MemorySizes
+	found := false
+	for _, arg := range vmArgs {
+		var target *int64
+		switch {
+		case strings.HasPrefix(arg, "-Xms"):
+			target = &m.Xms
+		case strings.HasPrefix(arg, "-Xmx"):
+			target = &m.Xmx
+		case strings.HasPrefix(arg, "-Xss"):
+			target = &m.Xss
+		case strings.HasPrefix(arg, "-Xmn"):
+			target = &m.Xmn
+		default:
+			continue
+		}
+		if size, ok := parseMemorySize(arg[4:]); ok {
+			*target = size
+			found = true
+		}
+	}
+	if !found {
+		return nil
+	}
+	return &m
 }
 
+// parseMemorySize parses a HotSpot memory size such as "512m" or "4G" into bytes.
+func parseMemorySize(value string) (int64, bool) {
+	if value == "" {
+		return 0, false
+	}
+	multiplier := int64(1)
+	switch value[len(value)-1] {
+	case 'k', 'K':
+		multiplier = 1 << 10
+	case 'm', 'M':
+		multiplier = 1 << 20
+	case 'g', 'G':
+		multiplier = 1 << 30
+	case 't', 'T':
+		multiplier = 1 << 40
+	}
+	if multiplier != 1 {
+		value = value[:len(value)-1]
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64/multiplier {
+		return 0, false
+	}
+	return n * multiplier, true
+}
+
+// unparseableMainClass is reported by -strict-parse for a command line whose main class would be a guess.
+const unparseableMainClass = "unparseable"
+
+// analyzeVmCmd splits a java command line into the main class or jar, the VM arguments and the
+// main arguments, see splitVmCmd.
 func analyzeVmCmd(cmdSlice []string, option JpsOption) (mainClassOrJar string, vmArgs string, mainArgs string) {
+	mainClassOrJar, vmArgList, mainArgs := splitVmCmd(cmdSlice, option)
+	if len(vmArgList) > 0 {
+		vmArgs = strings.Join(vmArgList, " ") + " "
+	}
+	return
+}
+
+// splitVmCmd splits a java command line into the main class or jar, the VM arguments as given
+// on the command line, so that values with spaces stay whole, and the main arguments. By default the first token that is not an option is taken as the main class,
+// which is a guess when an option takes a separate value or a launcher prepends tokens. With
+// -strict-parse a main class is only accepted after -cp, -classpath or --class-path, and a module
+// only after -m or --module; any other command line reports unparseableMainClass.
+func splitVmCmd(cmdSlice []string, option JpsOption) (mainClassOrJar string, vmArgs []string, mainArgs string) {
 	if len(cmdSlice) < 2 {
 		return
 	}
 	skipNext := false
+	classPathSeen := false
 	for i := 1; i < len(cmdSlice); i++ {
 		arg := cmdSlice[i]
 		if skipNext {
@@ -147,6 +817,7 @@ func analyzeVmCmd(cmdSlice []string, option JpsOption) (mainClassOrJar string, v
 		}
 		if arg == "-cp" || arg == "-classpath" {
 			skipNext = true
+			classPathSeen = true
 			continue
 		}
 		if arg == "-jar" && i+1 < len(cmdSlice) {
@@ -156,12 +827,37 @@ func analyzeVmCmd(cmdSlice []string, option JpsOption) (mainClassOrJar string, v
 			}
 			break
 		}
+		if option.StrictParse {
+			if arg == "--class-path" {
+				skipNext = true
+				classPathSeen = true
+				continue
+			}
+			if module, ok := moduleOption(cmdSlice, i); ok {
+				mainClassOrJar = module
+				next := i + 2
+				if strings.Contains(arg, "=") {
+					next = i + 1
+				}
+				if option.ShowArgs && next < len(cmdSlice) {
+					mainArgs = strings.Join(cmdSlice[next:], " ")
+				}
+				break
+			}
+			if strings.HasPrefix(arg, "--class-path=") {
+				classPathSeen = true
+			}
+		}
 		if strings.HasPrefix(arg, "-") {
-			if option.ShowVMArgs {
-				vmArgs += arg + " "
+			if option.ShowVMArgs || option.ShowXXFlags || option.ShowHeap {
+				vmArgs = append(vmArgs, arg)
 			}
 			continue
 		}
+		if option.StrictParse && !classPathSeen {
+			mainClassOrJar = unparseableMainClass
+			break
+		}
 		if mainClassOrJar == "" {
 			mainClassOrJar = arg
 			if option.ShowArgs && i+1 < len(cmdSlice) {
@@ -172,3 +868,15 @@ func analyzeVmCmd(cmdSlice []string, option JpsOption) (mainClassOrJar string, v
 	}
 	return
 }
+
+// moduleOption returns the module/mainclass of a -m, --module or --module= option at cmdSlice[i].
+func moduleOption(cmdSlice []string, i int) (string, bool) {
+	arg := cmdSlice[i]
+	if (arg == "-m" || arg == "--module") && i+1 < len(cmdSlice) {
+		return cmdSlice[i+1], true
+	}
+	if module, ok := strings.CutPrefix(arg, "--module="); ok && module != "" {
+		return module, true
+	}
+	return "", false
+}
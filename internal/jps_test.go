@@ -1,11 +1,17 @@
 package internal
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"os/user"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -22,6 +28,14 @@ func captureLogs() (restore func(), getLogs func() []string, clearLogs func()) {
 	return func() { globalLogger = origLogger }, func() []string { return logs }, func() { logs = nil }
 }
 
+// outputLines returns the lines a command wrote to out.
+func outputLines(out *bytes.Buffer) []string {
+	if out.Len() == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+}
+
 // prepareHsperfdataFile creates a fake hsperfdata file for the given user and pid, returning the file path and a cleanup function.
 func prepareHsperfdataFile(username string, pid int) (string, func(), error) {
 	tempDir := os.TempDir()
@@ -43,8 +57,7 @@ func prepareHsperfdataFile(username string, pid int) (string, func(), error) {
 
 // TestJpsList_ValidUser tests JpsList with a valid user and a fake Java process.
 func TestJpsList_ValidUser(t *testing.T) {
-	restore, getLogs, clearLogs := captureLogs()
-	defer restore()
+	var out bytes.Buffer
 
 	currentUser, err := user.Current()
 	if err != nil {
@@ -61,45 +74,85 @@ func TestJpsList_ValidUser(t *testing.T) {
 	}
 	defer cleanup()
 
-	clearLogs()
-	opt := JpsOption{User: currentUser.Username}
+	opt := JpsOption{User: currentUser.Username, Out: &out, ErrOut: &out}
 	JpsList(opt)
 	found := false
-	for _, l := range getLogs() {
+	for _, l := range outputLines(&out) {
 		if l != "" && l != "no java process" {
 			found = true
 			break
 		}
 	}
 	if !found {
-		t.Errorf("expected to find at least one java process, got logs: %v", getLogs())
+		t.Errorf("expected to find at least one java process, got logs: %v", outputLines(&out))
+	}
+}
+
+// TestDiscoverJavaProcesses_NotPerfData tests that a numeric file naming a live pid
+// is not treated as a JVM unless it looks like an hsperfdata file.
+func TestDiscoverJavaProcesses_NotPerfData(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	hsperfFile, cleanup, err := prepareHsperfdataFile("alice", os.Getpid())
+	if err != nil {
+		t.Fatalf("failed to create hsperfdata file: %v", err)
+	}
+	defer cleanup()
+
+	if pids, _ := DiscoverJavaProcesses("alice"); len(pids) != 1 {
+		t.Fatalf("expected the hsperfdata file to be discovered, got %v", pids)
+	}
+	if err := os.WriteFile(hsperfFile, []byte("not a perfdata file"), 0644); err != nil {
+		t.Fatalf("failed to overwrite hsperfdata file: %v", err)
+	}
+	if pids, _ := DiscoverJavaProcesses("alice"); len(pids) != 0 {
+		t.Errorf("expected the non-perfdata file to be skipped, got %v", pids)
+	}
+}
+
+// TestDiscoverJavaProcesses_NumericOrder tests that pids are sorted numerically rather than by file name.
+func TestDiscoverJavaProcesses_NumericOrder(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	origPidExists := pkg.PidExists
+	defer func() { pkg.PidExists = origPidExists }()
+	pkg.PidExists = func(pid int32) (bool, error) { return true, nil }
+	for _, pid := range []int{9, 100, 10, 2} {
+		_, cleanup, err := prepareHsperfdataFile("alice", pid)
+		if err != nil {
+			t.Fatalf("failed to create hsperfdata file: %v", err)
+		}
+		defer cleanup()
+	}
+
+	pids, err := DiscoverJavaProcesses("alice")
+	if err != nil {
+		t.Fatalf("DiscoverJavaProcesses failed: %v", err)
+	}
+	if fmt.Sprint(pids) != "[2 9 10 100]" {
+		t.Errorf("expected pids in numeric order, got %v", pids)
 	}
 }
 
 // TestJpsList_InvalidUser tests JpsList with a non-existent user.
 func TestJpsList_InvalidUser(t *testing.T) {
-	restore, getLogs, clearLogs := captureLogs()
-	defer restore()
+	var out bytes.Buffer
 
-	clearLogs()
-	opt := JpsOption{User: "nonexistent_user_12345"}
+	opt := JpsOption{User: "nonexistent_user_12345", Out: &out, ErrOut: &out}
 	JpsList(opt)
 	userErr := false
-	for _, l := range getLogs() {
+	for _, l := range outputLines(&out) {
 		if l == "user does not exist" {
 			userErr = true
 			break
 		}
 	}
 	if !userErr {
-		t.Errorf("expected 'user does not exist' error, got logs: %v", getLogs())
+		t.Errorf("expected 'user does not exist' error, got logs: %v", outputLines(&out))
 	}
 }
 
 // TestJpsList_NoJavaProcess tests JpsList when there are no hsperfdata files for the user.
 func TestJpsList_NoJavaProcess(t *testing.T) {
-	restore, getLogs, clearLogs := captureLogs()
-	defer restore()
+	var out bytes.Buffer
 
 	currentUser, err := user.Current()
 	if err != nil {
@@ -114,25 +167,23 @@ func TestJpsList_NoJavaProcess(t *testing.T) {
 	os.Remove(hsperfFile)
 	defer cleanup()
 
-	clearLogs()
-	opt := JpsOption{User: currentUser.Username}
+	opt := JpsOption{User: currentUser.Username, Out: &out, ErrOut: &out}
 	JpsList(opt)
 	noProc := false
-	for _, l := range getLogs() {
+	for _, l := range outputLines(&out) {
 		if l == "no java process" {
 			noProc = true
 			break
 		}
 	}
 	if !noProc {
-		t.Errorf("expected 'no java process' log, got logs: %v", getLogs())
+		t.Errorf("expected 'no java process' log, got logs: %v", outputLines(&out))
 	}
 }
 
 // TestJpsList_ActualJavaProcess tests JpsList with an actual local Java process.
 func TestJpsList_ActualJavaProcess(t *testing.T) {
-	restore, getLogs, clearLogs := captureLogs()
-	defer restore()
+	var out bytes.Buffer
 
 	currentUser, err := user.Current()
 	if err != nil {
@@ -147,23 +198,503 @@ func TestJpsList_ActualJavaProcess(t *testing.T) {
 
 	time.Sleep(2 * time.Second)
 
-	clearLogs()
 	opt := JpsOption{
 		User:       currentUser.Username,
 		ShowLong:   true,
 		ShowVMArgs: true,
 		ShowArgs:   true,
 		Quiet:      false,
+		Out:        &out,
+		ErrOut:     &out,
 	}
 	JpsList(opt)
 	found := false
-	for _, l := range getLogs() {
+	for _, l := range outputLines(&out) {
 		if strings.Contains(l, p.class) {
 			found = true
 			break
 		}
 	}
 	if !found {
-		t.Errorf("expected to find %s in logs, got: %v", p.class, getLogs())
+		t.Errorf("expected to find %s in logs, got: %v", p.class, outputLines(&out))
+	}
+}
+
+// TestPrintClassCounts tests that class counts are sorted descending by count and then by name.
+func TestPrintClassCounts(t *testing.T) {
+	var out bytes.Buffer
+
+	printClassCounts(newOutput(&out, nil), []JvmProcess{
+		{Pid: 1, mainClassOrJar: "AppMain"},
+		{Pid: 2, mainClassOrJar: "KafkaBroker"},
+		{Pid: 3, mainClassOrJar: "KafkaBroker"},
+		{Pid: 4, mainClassOrJar: "Zookeeper"},
+	})
+	expected := []string{"2 KafkaBroker", "1 AppMain", "1 Zookeeper"}
+	logs := outputLines(&out)
+	if strings.Join(logs, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected %v, got %v", expected, logs)
+	}
+}
+
+// TestParseXXFlags tests parsing of boolean and valued -XX options.
+func TestParseXXFlags(t *testing.T) {
+	flags := parseXXFlags([]string{"-Xmx1g", "-XX:+UseG1GC", "-XX:-UseConcMarkSweepGC", "-XX:MaxHeapSize=4g", "-Dfoo=bar", "-XX:"})
+	expected := []VMFlag{
+		{Name: "UseG1GC", Value: "true"},
+		{Name: "UseConcMarkSweepGC", Value: "false"},
+		{Name: "MaxHeapSize", Value: "4g"},
+	}
+	if len(flags) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, flags)
+	}
+	for i := range expected {
+		if flags[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected[i], flags[i])
+		}
+	}
+}
+
+// TestJpsList_XXFlags tests that -XX values with spaces are kept whole and that the flags are
+// printed in their own block after the process lines.
+func TestJpsList_XXFlags(t *testing.T) {
+	origProvider := ProcessProvider
+	defer func() { ProcessProvider = origProvider }()
+	ProcessProvider = func(pid int32) ([]string, error) {
+		return []string{"java", "-XX:+UseG1GC", "-XX:OnOutOfMemoryError=kill -9 %p", "com.example.App"}, nil
+	}
+
+	processes := collectProcessInfo([]int32{1, 2}, JpsOption{ShowXXFlags: true})
+	expected := []VMFlag{{Name: "UseG1GC", Value: "true"}, {Name: "OnOutOfMemoryError", Value: "kill -9 %p"}}
+	if len(processes) != 2 || fmt.Sprint(processes[0].xxFlags) != fmt.Sprint(expected) {
+		t.Fatalf("expected %v, got %v", expected, processes)
+	}
+
+	var out bytes.Buffer
+	o := newOutput(&out, nil)
+	for _, p := range processes {
+		printJps(o, p, JpsOption{ShowXXFlags: true})
+	}
+	printXXFlags(o, processes)
+	expectedLines := []string{
+		"1 com.example.App",
+		"2 com.example.App",
+		"== -XX flags ==",
+		"1 UseG1GC true",
+		"1 OnOutOfMemoryError kill -9 %p",
+		"2 UseG1GC true",
+		"2 OnOutOfMemoryError kill -9 %p",
+	}
+	if lines := outputLines(&out); strings.Join(lines, "\n") != strings.Join(expectedLines, "\n") {
+		t.Errorf("expected %v, got %v", expectedLines, lines)
+	}
+}
+
+// TestJpsValidate_Users tests validation of the -users and -strict options.
+func TestJpsValidate_Users(t *testing.T) {
+	currentUser, err := user.Current()
+	if err != nil {
+		t.Fatalf("failed to get current user: %v", err)
+	}
+
+	opt := JpsOption{Users: []string{currentUser.Username}}
+	if err := opt.JpsValidate(); err != nil {
+		t.Errorf("expected no error, got: %v", err)
+	}
+	opt = JpsOption{Users: []string{currentUser.Username, "nonexistent_user_12345"}}
+	if err := opt.JpsValidate(); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound, got: %v", err)
+	}
+	opt = JpsOption{User: currentUser.Username, Users: []string{currentUser.Username}}
+	if err := opt.JpsValidate(); err == nil {
+		t.Errorf("expected error for -user with -users")
+	}
+	opt = JpsOption{Strict: true}
+	if err := opt.JpsValidate(); err == nil {
+		t.Errorf("expected error for -strict without -users")
+	}
+}
+
+// TestParseJpsFlags_Users tests that -users is split on commas.
+func TestParseJpsFlags_Users(t *testing.T) {
+	opt, err := ParseJpsFlags([]string{"-users", "alice, bob,,svc", "-strict"})
+	if err != nil {
+		t.Fatalf("ParseJpsFlags failed: %v", err)
+	}
+	if strings.Join(opt.Users, "|") != "alice|bob|svc" || !opt.Strict {
+		t.Errorf("unexpected option: %+v", opt)
+	}
+}
+
+// TestCollectProcessInfo_Parallel feeds fake pids with varied command lines and delays through
+// ProcessProvider, checking completeness, pid ordering and the worker-pool cap.
+func TestCollectProcessInfo_Parallel(t *testing.T) {
+	origProvider := ProcessProvider
+	defer func() { ProcessProvider = origProvider }()
+
+	var inFlight, maxInFlight int32
+	ProcessProvider = func(pid int32) ([]string, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			m := atomic.LoadInt32(&maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Duration(pid%5) * time.Millisecond)
+		if pid%10 == 0 {
+			return nil, errors.New("process exited")
+		}
+		if pid%2 == 0 {
+			return []string{"java", "-jar", fmt.Sprintf("app%d.jar", pid)}, nil
+		}
+		return []string{"java", "-Xmx1g", fmt.Sprintf("com.example.Main%d", pid), "arg"}, nil
+	}
+
+	var pids []int32
+	for pid := int32(50); pid >= 1; pid-- {
+		pids = append(pids, pid)
+	}
+	processes := collectProcessInfo(pids, JpsOption{Concurrency: 4})
+
+	if len(processes) != 45 {
+		t.Fatalf("expected 45 processes, got %d", len(processes))
+	}
+	for i, p := range processes {
+		if i > 0 && processes[i-1].Pid >= p.Pid {
+			t.Errorf("expected processes sorted by pid, got %d before %d", processes[i-1].Pid, p.Pid)
+		}
+		expected := fmt.Sprintf("com.example.Main%d", p.Pid)
+		if p.Pid%2 == 0 {
+			expected = fmt.Sprintf("app%d.jar", p.Pid)
+		}
+		if p.mainClassOrJar != expected {
+			t.Errorf("expected main class %s for pid %d, got %s", expected, p.Pid, p.mainClassOrJar)
+		}
+	}
+	if maxInFlight > 4 {
+		t.Errorf("expected at most 4 concurrent provider calls, got %d", maxInFlight)
+	}
+}
+
+// TestPrintGroupedByUser tests that a header is printed before each owner's processes.
+func TestPrintGroupedByUser(t *testing.T) {
+	var out bytes.Buffer
+
+	processes := []JvmProcess{
+		{Pid: 10, mainClassOrJar: "App", User: user.User{Username: "alice"}},
+		{Pid: 20, mainClassOrJar: "Worker", User: user.User{Username: "alice"}},
+		{Pid: 5, mainClassOrJar: "Broker", User: user.User{Username: "bob"}},
+	}
+	printGroupedByUser(newOutput(&out, nil), processes, JpsOption{Users: []string{"alice", "bob"}, GroupByUser: true})
+	expected := []string{"== alice ==", "10 App", "20 Worker", "== bob ==", "5 Broker"}
+	if strings.Join(outputLines(&out), "|") != strings.Join(expected, "|") {
+		t.Errorf("expected %v, got %v", expected, outputLines(&out))
+	}
+
+	opt := JpsOption{GroupByUser: true}
+	if err := opt.JpsValidate(); err == nil {
+		t.Errorf("expected error for -group-by-user without -users")
+	}
+}
+
+// TestSampleCPU tests the utilization computed from two CPU time samples and that
+// processes exiting during sampling are omitted.
+func TestSampleCPU(t *testing.T) {
+	origProvider := CPUTimeProvider
+	defer func() { CPUTimeProvider = origProvider }()
+
+	var mu sync.Mutex
+	calls := map[int32]int{}
+	CPUTimeProvider = func(pid int32) (float64, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls[pid]++
+		if pid == 2 && calls[pid] > 1 {
+			return 0, errors.New("process exited")
+		}
+		// each call reports one more CPU second than the previous one
+		return float64(calls[pid]), nil
+	}
+
+	processes := sampleCPU([]JvmProcess{{Pid: 1}, {Pid: 2}}, 10*time.Millisecond)
+	if len(processes) != 1 || processes[0].Pid != 1 {
+		t.Fatalf("expected only pid 1 to be sampled, got %v", processes)
+	}
+	if processes[0].cpuPercent == nil || *processes[0].cpuPercent <= 0 {
+		t.Errorf("expected a positive CPU utilization, got %v", processes[0].cpuPercent)
+	}
+}
+
+// TestJpsActivity tests the hsperfdata mtime lookup and its relative rendering.
+func TestJpsActivity(t *testing.T) {
+	var out bytes.Buffer
+
+	t.Setenv("TMPDIR", t.TempDir())
+	hsperfFile, cleanup, err := prepareHsperfdataFile("alice", 12345)
+	if err != nil {
+		t.Fatalf("failed to create hsperfdata file: %v", err)
+	}
+	defer cleanup()
+	modTime := time.Now().Add(-90 * time.Second)
+	if err := os.Chtimes(hsperfFile, modTime, modTime); err != nil {
+		t.Fatalf("failed to set mtime: %v", err)
+	}
+
+	lastActivity := hsperfdataModTime("alice", 12345)
+	if lastActivity == nil || !lastActivity.Equal(modTime) {
+		t.Fatalf("expected mtime %v, got %v", modTime, lastActivity)
+	}
+	if hsperfdataModTime("alice", 54321) != nil {
+		t.Errorf("expected no mtime for a missing hsperfdata file")
+	}
+
+	printJps(newOutput(&out, nil), JvmProcess{Pid: 12345, mainClassOrJar: "App", lastActivity: lastActivity}, JpsOption{ShowActivity: true})
+	if logs := outputLines(&out); len(logs) != 1 || logs[0] != "12345 App updated 1m30s ago" {
+		t.Errorf("unexpected output: %v", logs)
+	}
+}
+
+// TestJpsList_OutputFile tests that -o writes the complete output to the file
+// and leaves it untouched when listing fails.
+func TestJpsList_OutputFile(t *testing.T) {
+	var out bytes.Buffer
+
+	currentUser, err := user.Current()
+	if err != nil {
+		t.Fatalf("failed to get current user: %v", err)
+	}
+	t.Setenv("TMPDIR", t.TempDir())
+	hsperfFile, cleanup, err := prepareHsperfdataFile(currentUser.Username, os.Getpid())
+	if err != nil {
+		t.Fatalf("failed to create hsperfdata file: %v", err)
+	}
+	defer cleanup()
+
+	output := filepath.Join(t.TempDir(), "inventory.json")
+	if code := JpsList(JpsOption{User: currentUser.Username, Json: true, Output: output, Out: &out, ErrOut: &out}); code != 0 {
+		t.Fatalf("expected exit code 0, got %d, logs: %v", code, outputLines(&out))
+	}
+	if len(outputLines(&out)) != 0 {
+		t.Errorf("expected no console output, got %v", outputLines(&out))
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	var processes []map[string]any
+	if err := json.Unmarshal(data, &processes); err != nil || len(processes) != 1 {
+		t.Errorf("expected a complete JSON array with one process, got %q, %v", data, err)
+	}
+
+	os.Remove(hsperfFile)
+	out.Reset()
+	if code := JpsList(JpsOption{User: currentUser.Username, Output: output, Out: &out, ErrOut: &out}); code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+	if logs := outputLines(&out); len(logs) != 1 || logs[0] != "no java process" {
+		t.Errorf("expected the failure on the console, got %v", logs)
+	}
+	if after, _ := os.ReadFile(output); string(after) != string(data) {
+		t.Errorf("expected the output file to be left untouched, got %q", after)
+	}
+}
+
+// TestParseMemorySizes tests suffix normalization, last-wins and absent flags.
+func TestParseMemorySizes(t *testing.T) {
+	m := parseMemorySizes([]string{"-Xms512m", "-Xmx2g", "-Xss1024k", "-XX:+UseG1GC", "-Xmx4G", "-Xmnbogus"})
+	if m == nil {
+		t.Fatalf("expected memory sizes")
+	}
+	expected := MemorySizes{Xms: 512 << 20, Xmx: 4 << 30, Xss: 1 << 20}
+	if *m != expected {
+		t.Errorf("expected %+v, got %+v", expected, *m)
+	}
+	if cols := strings.Join(m.columns(), " "); cols != "xms=536870912 xmx=4294967296 xss=1048576" {
+		t.Errorf("unexpected columns: %s", cols)
+	}
+	if m := parseMemorySizes([]string{"-XX:+UseG1GC", "-Xmx"}); m != nil {
+		t.Errorf("expected nil for no sizing flags, got %+v", m)
+	}
+	if _, ok := parseMemorySize("99999999999t"); ok {
+		t.Errorf("expected overflow to be rejected")
+	}
+	if size, ok := parseMemorySize("1048576"); !ok || size != 1048576 {
+		t.Errorf("expected plain bytes, got %d, %v", size, ok)
+	}
+}
+
+// TestRedactCmdline tests masking of secret-looking system properties.
+func TestRedactCmdline(t *testing.T) {
+	cmdSlice := []string{"java", "-Dspring.datasource.password=hunter2", "-Dapp.API_TOKEN=abc", "-Dapp.name=demo", "-Dflag", "-Xmx1g", "com.example.App", "--password=kept"}
+	redacted := redactCmdline(cmdSlice, splitList(defaultRedactKeys))
+	expected := []string{"java", "-Dspring.datasource.password=***", "-Dapp.API_TOKEN=***", "-Dapp.name=demo", "-Dflag", "-Xmx1g", "com.example.App", "--password=kept"}
+	if strings.Join(redacted, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected %v, got %v", expected, redacted)
+	}
+	if cmdSlice[1] != "-Dspring.datasource.password=hunter2" {
+		t.Errorf("expected the input to be left unchanged")
+	}
+	if redacted := redactCmdline(cmdSlice, []string{"name"}); redacted[3] != "-Dapp.name=***" || redacted[1] != cmdSlice[1] {
+		t.Errorf("expected custom keys to apply, got %v", redacted)
+	}
+}
+
+// TestJpsList_Max tests that -max keeps the lowest pids and warns about the truncation.
+func TestJpsList_Max(t *testing.T) {
+	var out bytes.Buffer
+
+	currentUser, err := user.Current()
+	if err != nil {
+		t.Fatalf("failed to get current user: %v", err)
+	}
+	t.Setenv("TMPDIR", t.TempDir())
+	for _, pid := range []int{300, 100, 200} {
+		_, cleanup, err := prepareHsperfdataFile(currentUser.Username, pid)
+		if err != nil {
+			t.Fatalf("failed to create hsperfdata file: %v", err)
+		}
+		defer cleanup()
+	}
+	origPidExists, origProvider := pkg.PidExists, ProcessProvider
+	defer func() { pkg.PidExists, ProcessProvider = origPidExists, origProvider }()
+	pkg.PidExists = func(pid int32) (bool, error) { return true, nil }
+	ProcessProvider = func(pid int32) ([]string, error) { return []string{"java", "com.example.App"}, nil }
+
+	if code := JpsList(JpsOption{User: currentUser.Username, Quiet: true, Max: 2, Out: &out, ErrOut: &out}); code != 0 {
+		t.Fatalf("expected exit code 0, got %d, logs: %v", code, outputLines(&out))
+	}
+	expected := []string{"100", "200", "warning: list truncated by -max, inspected 2 of 3 java processes"}
+	if logs := outputLines(&out); strings.Join(logs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected %v, got %v", expected, logs)
+	}
+
+	if code := JpsList(JpsOption{User: currentUser.Username, Max: -1, Out: &out, ErrOut: &out}); code != 1 {
+		t.Errorf("expected exit code 1 for a negative max, got %d", code)
+	}
+}
+
+// TestPrintJps_Container tests the container column and the warning for a heap above the limit.
+func TestPrintJps_Container(t *testing.T) {
+	var out bytes.Buffer
+
+	o := newOutput(&out, nil)
+	option := JpsOption{ShowContainer: true}
+	printJps(o, JvmProcess{Pid: 1, mainClassOrJar: "App", memory: &MemorySizes{Xmx: 1 << 30, Container: 2 << 30}}, option)
+	printJps(o, JvmProcess{Pid: 2, mainClassOrJar: "App", memory: &MemorySizes{Xmx: 4 << 30, Container: 2 << 30}}, option)
+	printJps(o, JvmProcess{Pid: 3, mainClassOrJar: "App"}, option)
+	expected := []string{
+		"1 App container=2147483648",
+		"2 App container=2147483648 (xmx exceeds container)",
+		"3 App",
+	}
+	if logs := outputLines(&out); strings.Join(logs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected %v, got %v", expected, logs)
+	}
+}
+
+// TestPrintJps_Classes tests the classes column and the -warn-classes flag.
+func TestPrintJps_Classes(t *testing.T) {
+	var out bytes.Buffer
+
+	classes, many := int64(9000), int64(60000)
+	o := newOutput(&out, nil)
+	option := JpsOption{ShowClasses: true, WarnClasses: 50000}
+	printJps(o, JvmProcess{Pid: 1, mainClassOrJar: "App", classes: &classes}, option)
+	printJps(o, JvmProcess{Pid: 2, mainClassOrJar: "App", classes: &many}, option)
+	printJps(o, JvmProcess{Pid: 3, mainClassOrJar: "App"}, option)
+	expected := []string{
+		"1 App classes=9000",
+		"2 App classes=60000 (classes exceed 50000)",
+		"3 App",
+	}
+	if logs := outputLines(&out); strings.Join(logs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected %v, got %v", expected, logs)
+	}
+
+	opt, err := ParseJpsFlags([]string{"-warn-classes", "50000"})
+	if err != nil || !opt.ShowClasses || opt.WarnClasses != 50000 {
+		t.Errorf("expected -warn-classes to imply -classes, got %+v, %v", opt, err)
+	}
+}
+
+// TestLiveClasses tests that unloaded classes are subtracted, including those of the CDS archive.
+func TestLiveClasses(t *testing.T) {
+	classes, ok := liveClasses(perfDataOf(map[string]int64{
+		"java.cls.loadedClasses":         1000,
+		"java.cls.unloadedClasses":       100,
+		"java.cls.sharedLoadedClasses":   500,
+		"java.cls.sharedUnloadedClasses": 50,
+	}))
+	if !ok || classes != 1350 {
+		t.Errorf("expected 1350 live classes, got %d, %v", classes, ok)
+	}
+	if _, ok := liveClasses(perfDataOf(nil)); ok {
+		t.Errorf("expected no class count without counters")
+	}
+}
+
+// TestAnalyzeVmCmd_StrictParse tests main class detection on adversarial command lines,
+// leniently and with -strict-parse.
+func TestAnalyzeVmCmd_StrictParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmd     []string
+		lenient string
+		strict  string
+	}{
+		{"classpath", []string{"java", "-Xmx1g", "-cp", "app.jar", "com.example.App", "arg"}, "com.example.App", "com.example.App"},
+		{"long classpath", []string{"java", "--class-path", "app.jar", "com.example.App"}, "app.jar", "com.example.App"},
+		{"classpath with equals", []string{"java", "--class-path=app.jar", "com.example.App"}, "com.example.App", "com.example.App"},
+		{"jar", []string{"java", "-jar", "app.jar", "arg"}, "app.jar", "app.jar"},
+		{"module", []string{"java", "-m", "app/com.example.App", "arg"}, "app/com.example.App", "app/com.example.App"},
+		{"module with equals", []string{"java", "--module=app/com.example.App"}, "", "app/com.example.App"},
+		{"no classpath", []string{"java", "com.example.App"}, "com.example.App", "unparseable"},
+		{"option with separate value", []string{"java", "--add-opens", "java.base/java.lang=ALL-UNNAMED", "-cp", "app.jar", "com.example.App"}, "java.base/java.lang=ALL-UNNAMED", "unparseable"},
+		{"prepended launcher", []string{"/usr/bin/env", "java", "-cp", "app.jar", "com.example.App"}, "java", "unparseable"},
+		{"shell wrapper", []string{"/bin/sh", "-c", "exec java -cp app.jar com.example.App"}, "exec java -cp app.jar com.example.App", "unparseable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if mainClass, _, _ := analyzeVmCmd(tt.cmd, JpsOption{}); mainClass != tt.lenient {
+				t.Errorf("expected lenient main class %q, got %q", tt.lenient, mainClass)
+			}
+			if mainClass, _, _ := analyzeVmCmd(tt.cmd, JpsOption{StrictParse: true}); mainClass != tt.strict {
+				t.Errorf("expected strict main class %q, got %q", tt.strict, mainClass)
+			}
+		})
+	}
+
+	for _, module := range [][]string{{"--module=app/com.example.App"}, {"-m", "app/com.example.App"}} {
+		cmd := append(append([]string{"java"}, module...), "a", "b")
+		if _, _, mainArgs := analyzeVmCmd(cmd, JpsOption{StrictParse: true, ShowArgs: true}); mainArgs != "a b" {
+			t.Errorf("expected main args \"a b\" for %v, got %q", cmd, mainArgs)
+		}
+	}
+}
+
+// TestCmdlineOrFallback tests that a process whose command line cannot be read at all is still
+// listed, with an empty command line.
+func TestCmdlineOrFallback(t *testing.T) {
+	failed := func() ([]string, error) { return nil, errors.New("sysctl restricted") }
+	fallback := func(pid int32) ([]string, error) { return []string{"java", "com.example.App"}, nil }
+	noFallback := func(pid int32) ([]string, error) { return nil, errors.New("no fallback") }
+
+	if cmdSlice := cmdlineOrFallback(4242, failed, fallback); strings.Join(cmdSlice, " ") != "java com.example.App" {
+		t.Errorf("expected the fallback command line, got %v", cmdSlice)
+	}
+	if cmdSlice := cmdlineOrFallback(4242, failed, noFallback); len(cmdSlice) != 0 {
+		t.Errorf("expected an empty command line, got %v", cmdSlice)
+	}
+
+	origProvider := ProcessProvider
+	defer func() { ProcessProvider = origProvider }()
+	ProcessProvider = func(pid int32) ([]string, error) {
+		return cmdlineOrFallback(pid, failed, noFallback), nil
+	}
+	processes := collectProcessInfo([]int32{4242}, JpsOption{})
+	if len(processes) != 1 || processes[0].Pid != 4242 || processes[0].Cmd != "" {
+		t.Errorf("expected pid 4242 with an empty command line, got %+v", processes)
 	}
 }
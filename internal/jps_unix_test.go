@@ -0,0 +1,72 @@
+//go:build unix
+
+package internal
+
+import (
+	"bytes"
+	"os"
+	"os/user"
+	"strconv"
+	"testing"
+
+	"github.com/XHao/jvmtool/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestJpsList_Sockets tests that -sockets finds a JVM with an attach socket but no hsperfdata file.
+func TestJpsList_Sockets(t *testing.T) {
+	var out bytes.Buffer
+
+	currentUser, err := user.Current()
+	if err != nil {
+		t.Fatalf("failed to get current user: %v", err)
+	}
+	server, cleanup, err := startAttachServer(int32(os.Getpid()), cannedResponse("0", ""))
+	if err != nil {
+		t.Fatalf("failed to start attach server: %v", err)
+	}
+	defer cleanup()
+	t.Setenv("TMPDIR", server.dir)
+
+	assert.Equal(t, []int32{int32(os.Getpid())}, discoverSocketPids(currentUser.Username))
+
+	assert.Equal(t, 1, JpsList(JpsOption{User: currentUser.Username, Quiet: true, Out: &out, ErrOut: &out}))
+	out.Reset()
+	assert.Equal(t, 0, JpsList(JpsOption{User: currentUser.Username, Quiet: true, Sockets: true, Out: &out, ErrOut: &out}))
+	assert.Equal(t, []string{strconv.Itoa(os.Getpid())}, outputLines(&out))
+}
+
+func TestMergePids(t *testing.T) {
+	assert.Equal(t, []int32{3, 1, 2}, mergePids([]int32{3, 1}, []int32{1, 2, 2}))
+	assert.Equal(t, []int32{5}, mergePids(nil, []int32{5}))
+}
+
+// TestJpsList_AmbiguousPids tests that a pid listed under several users is marked and explained.
+func TestJpsList_AmbiguousPids(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	for _, owner := range []struct {
+		user string
+		pids []int
+	}{{"root", []int{10, 20}}, {"daemon", []int{10}}} {
+		for _, pid := range owner.pids {
+			_, cleanup, err := prepareHsperfdataFile(owner.user, pid)
+			if err != nil {
+				t.Fatalf("failed to create hsperfdata file: %v", err)
+			}
+			defer cleanup()
+		}
+	}
+	origPidExists, origProvider := pkg.PidExists, ProcessProvider
+	defer func() { pkg.PidExists, ProcessProvider = origPidExists, origProvider }()
+	pkg.PidExists = func(pid int32) (bool, error) { return true, nil }
+	ProcessProvider = func(pid int32) ([]string, error) { return []string{"java", "com.example.App"}, nil }
+
+	var out, errOut bytes.Buffer
+	assert.Equal(t, 0, JpsList(JpsOption{Users: []string{"root", "daemon"}, Out: &out, ErrOut: &errOut}))
+	assert.Equal(t, []string{"10 root* com.example.App", "20 root com.example.App", "10 daemon* com.example.App"}, outputLines(&out))
+	assert.Equal(t, []string{"warning: pid 10 is ambiguous, it appears under users root, daemon (possibly different PID namespaces)"}, outputLines(&errOut))
+
+	out.Reset()
+	assert.Equal(t, 0, JpsList(JpsOption{Users: []string{"root", "daemon"}, GroupByClass: true, Out: &out}))
+	assert.Equal(t, []string{"2 com.example.App"}, outputLines(&out))
+}
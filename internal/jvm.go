@@ -1,46 +1,132 @@
 package internal
 
 import (
+	"bufio"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"os/user"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
-	"golang.org/x/sys/unix"
+	"github.com/XHao/jvmtool/pkg"
 )
 
+// defaultProtocolVersion is the attach protocol version spoken by HotSpot.
+const defaultProtocolVersion = "1"
+
+// attachTimeout is how long checkSocket waits for the JVM to create its attach socket.
+const attachTimeout = 9 * time.Second
+
+// defaultPollInterval is how often checkSocket looks for the attach socket unless PollInterval is set.
+const defaultPollInterval = 100 * time.Millisecond
+
+// defaultMaxResponseSize is the response size limit used by commands unless -maxresponse is given.
+const defaultMaxResponseSize = 16 << 20
+
 type JvmProcess struct {
 	Pid int32
 	Cmd string
 	user.User
 
+	// ProtocolVersion is sent as the first request field; empty means defaultProtocolVersion.
+	ProtocolVersion string
+	// SocketDir and AttachFileDir locate the .java_pid socket and the .attach_pid trigger file.
+	// Both default to os.TempDir(); they differ only in bespoke container layouts.
+	SocketDir     string
+	AttachFileDir string
+	// MaxResponseSize caps the attach response in bytes; 0 means unlimited.
+	MaxResponseSize int
+	// TriggerSignal is how checkSocket asks the JVM to start its attach listener, see triggerSignals.
+	// Empty means SIGQUIT.
+	TriggerSignal string
+	// PollInterval is how often checkSocket looks for the attach socket; 0 means defaultPollInterval.
+	PollInterval time.Duration
+
 	mainClassOrJar string
 	vmArgs         string
 	mainArgs       string
+	xxFlags        []VMFlag
+	cpuPercent     *float64
+	lastActivity   *time.Time
+	classes        *int64
+	memory         *MemorySizes
+	ambiguous      bool // the pid was also found under another user
+
+	// connect overrides how the attach listener is reached; nil means the local unix socket.
+	connect connectFunc
+	// now and sleep override the clock of checkSocket; nil means time.Now and time.Sleep.
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// jvmProcessJSON is the stable JSON schema of a JvmProcess.
+type jvmProcessJSON struct {
+	Pid          int32        `json:"pid"`
+	User         string       `json:"user,omitempty"`
+	Cmd          string       `json:"cmd"`
+	MainClass    string       `json:"mainClass"`
+	VMArgs       string       `json:"vmArgs,omitempty"`
+	MainArgs     string       `json:"mainArgs,omitempty"`
+	XXFlags      []VMFlag     `json:"xxFlags,omitempty"`
+	CPU          *float64     `json:"cpuPercent,omitempty"`
+	LastActivity *time.Time   `json:"lastActivity,omitempty"`
+	Classes      *int64       `json:"classes,omitempty"`
+	Memory       *MemorySizes `json:"memory,omitempty"`
+	Ambiguous    bool         `json:"ambiguous,omitempty"`
+}
+
+// MarshalJSON encodes the process with a stable schema, including the unexported
+// parsed fields and only the username of the embedded user.User.
+func (jp JvmProcess) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jvmProcessJSON{
+		Pid:          jp.Pid,
+		User:         jp.Username,
+		Cmd:          jp.Cmd,
+		MainClass:    jp.mainClassOrJar,
+		VMArgs:       strings.TrimSpace(jp.vmArgs),
+		MainArgs:     jp.mainArgs,
+		XXFlags:      jp.xxFlags,
+		CPU:          jp.cpuPercent,
+		LastActivity: jp.lastActivity,
+		Classes:      jp.classes,
+		Memory:       jp.memory,
+		Ambiguous:    jp.ambiguous,
+	})
 }
 
 // jdk/src/jdk.attach/share/classes/sun/tools/attach/HotSpotVirtualMachine.java
 func (jp *JvmProcess) checkSocket() error {
-	socketPath := fmt.Sprintf("%s/.java_pid%d", os.TempDir(), jp.Pid)
-	attachFile := fmt.Sprintf("%s/.attach_pid%d", os.TempDir(), jp.Pid)
+	socketPath := jp.socketPath()
+	attachFile := jp.attachFilePath()
+	interval := jp.PollInterval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	now, sleep := jp.now, jp.sleep
+	if now == nil {
+		now = time.Now
+	}
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+	start := now()
 	var created bool
-	timeout := 9_000
-	timeSpend := 0
 	for {
 		_, err := os.Stat(socketPath)
 		if err == nil {
 			return nil
 		}
-		if timeSpend > timeout {
+		if now().Sub(start) >= attachTimeout {
 			break
 		}
 		if created {
-			time.Sleep(1000 * time.Millisecond)
-			timeSpend += 1000
+			sleep(interval)
 			continue
 		}
 		created = true
@@ -50,116 +136,399 @@ func (jp *JvmProcess) checkSocket() error {
 		}
 		defer os.Remove(attachFile)
 		if err != nil {
+			if isPermissionError(err) {
+				return fmt.Errorf("attach failed, cannot create file %s: %w; %w", attachFile, err, ErrPermissionDenied)
+			}
 			return fmt.Errorf("attach failed, cannot create file, %v", err.Error())
-		} else {
+		} else if sig, send, err := parseTriggerSignal(jp.TriggerSignal); err != nil {
+			return err
+		} else if send {
 			p, err := os.FindProcess(int(jp.Pid))
 			if err != nil {
 				return fmt.Errorf("java process does not exist, %v", jp.Pid)
 			}
-			err = p.Signal(syscall.SIGQUIT)
+			err = p.Signal(sig)
 			if err != nil {
-				return fmt.Errorf("cannot send signal %v to Java process", syscall.SIGQUIT)
+				if isPermissionError(err) {
+					return fmt.Errorf("cannot send signal %v to Java process: %w; %w", sig, err, ErrPermissionDenied)
+				}
+				return fmt.Errorf("cannot send signal %v to Java process", sig)
 			}
 		}
-		time.Sleep(1000 * time.Millisecond)
-		timeSpend += 1000
+		sleep(interval)
 	}
-	return fmt.Errorf("unable to open socket file %s: target process %d doesn't respond within %dms or HotSpot VM not loaded", socketPath, jp.Pid, timeSpend)
+	err := fmt.Errorf("unable to open socket file %s: target process %d doesn't respond within %dms or HotSpot VM not loaded", socketPath, jp.Pid, now().Sub(start).Milliseconds())
+	if reason := jp.diagnoseAttachTimeout(); reason != "" {
+		err = fmt.Errorf("%w; likely cause: %s", err, reason)
+	}
+	return err
 }
 
-func (jp *JvmProcess) loadAgent(agentPath string, params string) error {
-	socketPath := fmt.Sprintf("%s/.java_pid%d", os.TempDir(), jp.Pid)
-	fd, err := unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+// triggerSignalNone creates the .attach_pid file without signalling the JVM, for JVMs whose
+// listener is started another way, e.g. with -XX:+StartAttachListener, or to avoid the thread
+// dump that SIGQUIT prints when the listener cannot be started.
+const triggerSignalNone = "none"
+
+// parseTriggerSignal resolves a TriggerSignal name. HotSpot only checks for the .attach_pid
+// file when it receives SIGQUIT, so that is the only signal accepted.
+func parseTriggerSignal(name string) (sig syscall.Signal, send bool, err error) {
+	switch strings.TrimPrefix(strings.ToUpper(name), "SIG") {
+	case "", "QUIT", "3":
+		return syscall.SIGQUIT, true, nil
+	case "NONE":
+		return 0, false, nil
+	}
+	return 0, false, fmt.Errorf("unsupported trigger signal %q: the JVM only starts its attach listener on SIGQUIT, use QUIT or %s", name, triggerSignalNone)
+}
+
+// connectFunc opens a connection to the attach listener of the JVM with the given pid.
+type connectFunc func(pid int32) (net.Conn, error)
+
+// socketPath returns the path of the attach listener's unix socket, .java_pid<pid>.
+func (jp *JvmProcess) socketPath() string {
+	return fmt.Sprintf("%s/.java_pid%d", orTempDir(jp.SocketDir), jp.Pid)
+}
+
+// attachFilePath returns the path of the .attach_pid<pid> trigger file that asks the JVM to start its attach listener.
+func (jp *JvmProcess) attachFilePath() string {
+	return fmt.Sprintf("%s/.attach_pid%d", orTempDir(jp.AttachFileDir), jp.Pid)
+}
+
+// orTempDir returns dir, or os.TempDir() if dir is empty.
+func orTempDir(dir string) string {
+	if dir == "" {
+		return os.TempDir()
+	}
+	return dir
+}
+
+// dial connects to the attach listener using jp.connect, falling back to the local unix socket.
+func (jp *JvmProcess) dial() (net.Conn, error) {
+	if jp.connect != nil {
+		return jp.connect(jp.Pid)
+	}
+	return net.Dial("unix", jp.socketPath())
+}
+
+// attachArgCount is the number of arguments the HotSpot attach listener reads for every command.
+const attachArgCount = 3
+
+// execute sends an attach command with up to attachArgCount arguments and returns the raw response.
+// The request is the protocol version, the command and the arguments, each NUL-terminated.
+func (jp *JvmProcess) execute(cmd string, args ...string) (string, error) {
+	conn, err := jp.request(cmd, args...)
 	if err != nil {
-		return fmt.Errorf("failed to create unix socket: %v", err.Error())
+		return "", err
 	}
-	addr := unix.SockaddrUnix{
-		Name: socketPath,
+	defer conn.Close()
+
+	resp, err := readAttachResponse(conn, jp.Pid, jp.MaxResponseSize)
+	if err != nil {
+		if jp.exitedDuringAttach() {
+			return "", ErrJvmExited
+		}
+		return "", err
+	}
+	if len(resp) == 0 {
+		if jp.exitedDuringAttach() {
+			return "", ErrJvmExited
+		}
+		return "", fmt.Errorf("target VM did not respond")
+	}
+	return resp, nil
+}
+
+// executeStream runs an attach command like execute, but calls onLine with each line of the
+// response, without its newline, as soon as the JVM writes it. An error returned by onLine stops
+// reading, closes the connection and is returned. MaxResponseSize applies to the whole response.
+func (jp *JvmProcess) executeStream(cmd string, onLine func(line string) error, args ...string) error {
+	conn, err := jp.request(cmd, args...)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	size, lines := 0, 0
+	for {
+		line, err := reader.ReadString('\n')
+		size += len(line)
+		if jp.MaxResponseSize > 0 && size > jp.MaxResponseSize {
+			return fmt.Errorf("attach response from process %v: %w (limit %d bytes)", jp.Pid, ErrResponseTooLarge, jp.MaxResponseSize)
+		}
+		if line != "" {
+			lines++
+			if err := onLine(strings.TrimSuffix(line, "\n")); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if jp.exitedDuringAttach() {
+				return ErrJvmExited
+			}
+			return fmt.Errorf("failed to read attach response from process %v: %v", jp.Pid, err.Error())
+		}
+	}
+	if lines == 0 {
+		if jp.exitedDuringAttach() {
+			return ErrJvmExited
+		}
+		return fmt.Errorf("target VM did not respond")
+	}
+	return nil
+}
+
+// request connects to the attach listener and sends the request for cmd, returning the
+// connection to read the response from.
+func (jp *JvmProcess) request(cmd string, args ...string) (net.Conn, error) {
+	if len(args) > attachArgCount {
+		return nil, fmt.Errorf("too many arguments for attach command %s: %d", cmd, len(args))
 	}
-	err = unix.Connect(fd, &addr)
+	conn, err := jp.dial()
 	if err != nil {
-		return fmt.Errorf("failed to connect to target process %v: %v %v", jp.Pid, socketPath, err.Error())
+		if jp.exitedDuringAttach() {
+			return nil, ErrJvmExited
+		}
+		if isPermissionError(err) {
+			return nil, fmt.Errorf("failed to connect to target process %v: %w; %w", jp.Pid, err, ErrPermissionDenied)
+		}
+		return nil, fmt.Errorf("failed to connect to target process %v: %v", jp.Pid, err.Error())
 	}
-	defer unix.Close(fd)
 
+	version := jp.ProtocolVersion
+	if version == "" {
+		version = defaultProtocolVersion
+	}
 	request := make([]byte, 0)
 	// Protocol version
-	request = append(request, byte('1'))
-	request = append(request, byte(0))
-	// Command: "load"
-	request = append(request, []byte("load")...)
+	request = append(request, []byte(version)...)
 	request = append(request, byte(0))
-	// Argument 1: "instrument"
-	request = append(request, []byte("instrument")...)
+	// Command
+	request = append(request, []byte(cmd)...)
 	request = append(request, byte(0))
-	// Argument 2: "false"
-	request = append(request, []byte("false")...)
-	request = append(request, byte(0))
-	// Argument 3: agent JAR path (with optional params)
-	request = append(request, []byte(agentPath)...)
-	if params != "" {
-		request = append(request, []byte("="+params)...)
+	// Arguments, padded with empty strings
+	for i := 0; i < attachArgCount; i++ {
+		if i < len(args) {
+			request = append(request, []byte(args[i])...)
+		}
+		request = append(request, byte(0))
 	}
-	request = append(request, byte(0))
 
-	if _, err = unix.Write(fd, request); err != nil {
-		return fmt.Errorf("failed to write attach request to process %v: %v", jp.Pid, err.Error())
+	if _, err = conn.Write(request); err != nil {
+		conn.Close()
+		if jp.exitedDuringAttach() {
+			return nil, ErrJvmExited
+		}
+		return nil, fmt.Errorf("failed to write attach request to process %v: %v", jp.Pid, err.Error())
 	}
+	return conn, nil
+}
 
-	log("waiting for attach to complete...")
-	resp, err := readAttachResponse(fd, jp.Pid)
+// jcmd runs a diagnostic command (e.g. "GC.run") through the attach listener and returns its output.
+func (jp *JvmProcess) jcmd(command string) (string, error) {
+	resp, err := jp.execute("jcmd", command)
 	if err != nil {
-		return err
+		return "", err
+	}
+	code, output, _ := strings.Cut(resp, "\n")
+	if code != "0" {
+		return "", fmt.Errorf("jcmd %s failed, return code %s: %s", command, code, strings.TrimSpace(output))
 	}
-	log("attach operation completed")
+	return output, nil
+}
 
-	if len(resp) == 0 {
-		return fmt.Errorf("target VM did not respond")
+// jcmdStream runs a diagnostic command like jcmd, passing each line of its output to onLine as
+// the JVM writes it, e.g. to print a long Thread.print incrementally.
+func (jp *JvmProcess) jcmdStream(command string, onLine func(line string) error) error {
+	var code string
+	var failure []string
+	first := true
+	err := jp.executeStream("jcmd", func(line string) error {
+		switch {
+		case first:
+			code, first = line, false
+		case code == "0":
+			return onLine(line)
+		default:
+			failure = append(failure, line)
+		}
+		return nil
+	}, command)
+	if err != nil {
+		return err
 	}
-	ret := strings.Split(resp, "\n")
-	returnCode := ret[0]
-	if returnCode != "0" {
-		return fmt.Errorf("agent load failed, return code: %s", returnCode)
+	if code != "0" {
+		return fmt.Errorf("jcmd %s failed, return code %s: %s", command, code, strings.TrimSpace(strings.Join(failure, "\n")))
+	}
+	return nil
+}
+
+func (jp *JvmProcess) loadAgent(agentPath string, params string) error {
+	_, err := jp.loadAgentResult(agentPath, params)
+	return err
+}
+
+// LoadResult is the decoded response of the load command. Agents that report key=value
+// status lines after the return code have them parsed into Status; any other body is kept in Body.
+type LoadResult struct {
+	Code   string            `json:"code,omitempty"`
+	Status map[string]string `json:"status,omitempty"`
+	Body   string            `json:"body,omitempty"`
+	raw    string            // the undecoded response, kept for AttachError
+}
+
+// AttachError is returned when the JVM answers a load command with an agent return code that
+// jvmtool does not know. It keeps the complete response, so new failure modes can be diagnosed.
+type AttachError struct {
+	code     string
+	response string
+}
+
+func (e *AttachError) Error() string {
+	return fmt.Sprintf("agent load failed, unknown code %s, response: %q", e.code, e.response)
+}
+
+// Code returns the agent return code parsed from the response.
+func (e *AttachError) Code() string {
+	return e.code
+}
+
+// Response returns the raw response of the JVM.
+func (e *AttachError) Response() string {
+	return e.response
+}
 
+// loadAgentResult loads a Java agent and returns the decoded response alongside any error.
+func (jp *JvmProcess) loadAgentResult(agentPath string, params string) (LoadResult, error) {
+	// Arguments: "instrument", "false" (not an absolute native path), agent JAR path with optional params
+	agentArg := agentPath
+	if params != "" {
+		agentArg += "=" + params
 	}
-	var errCode string
-	if strings.HasPrefix(ret[1], "return code: ") {
-		errCode = ret[1][13:]
-	} else {
-		b := ret[1][0]
-		if b == '-' || (b >= '0' && b <= '9') {
-			errCode = ret[1]
-		} else {
-			errCode = "-1"
-		}
+
+	result, message, err := jp.load("instrument", false, agentArg)
+	if err != nil {
+		return result, err
 	}
 
-	switch errCode {
+	switch result.Code {
 	case "-1":
-		return errors.New(ret[1])
+		return result, errors.New(message)
 	case "0":
-		return nil
+		return result, nil
 	case "100":
-		return fmt.Errorf("agent load failed, code 100: Agent JAR not found or no Agent-Class attribute")
+		return result, fmt.Errorf("agent load failed, code 100: %w", ErrAgentClassMissing)
 	case "101":
-		return fmt.Errorf("agent load failed, code 101: Unable to add JAR file to system class path")
+		return result, fmt.Errorf("agent load failed, code 101: %w", ErrAgentClassPath)
 	case "102":
-		return fmt.Errorf("agent load failed, code 102: No agentmain method or agentmain failed")
+		return result, fmt.Errorf("agent load failed, code 102: %w", ErrAgentMainFailed)
+	}
+	return result, &AttachError{code: result.Code, response: result.raw}
+}
+
+// load runs the load command for a JVMTI agent library with the given options. absolute tells the
+// JVM whether library is a path or a name to look up in its library path. It returns the decoded
+// response and the message line reported in place of the agent's return code, if any.
+func (jp *JvmProcess) load(library string, absolute bool, options string) (LoadResult, string, error) {
+	logInfo("waiting for attach to complete...")
+	resp, err := jp.execute("load", library, strconv.FormatBool(absolute), options)
+	if err != nil {
+		return LoadResult{}, "", err
 	}
-	return fmt.Errorf("agent load failed, unknown message: %s", ret[1])
+	logInfo("attach operation completed")
+
+	returnCode, result, message := parseLoadResponse(resp)
+	if returnCode == "" {
+		return LoadResult{}, "", fmt.Errorf("agent load failed, malformed response: %q", resp)
+	}
+	if returnCode != "0" {
+		return LoadResult{Code: returnCode}, "", fmt.Errorf("agent load failed, return code: %s", returnCode)
+	}
+	result.raw = resp
+	return result, message, nil
 }
 
-func readAttachResponse(fd int, pid int32) (resp string, err error) {
+// parseLoadResponse decodes a load response: the attach return code on the first line, then the
+// agent's return code ("<n>" or "return code: <n>") or an error message, then any agent output.
+// When the second line is missing or empty, the attach return code is also the agent's.
+// A message in place of the agent's return code is reported with code "-1".
+func parseLoadResponse(resp string) (returnCode string, result LoadResult, message string) {
+	lines := strings.Split(strings.TrimSuffix(resp, "\n"), "\n")
+	returnCode = strings.TrimSpace(lines[0])
+	if len(lines) < 2 || strings.TrimSpace(lines[1]) == "" {
+		return returnCode, LoadResult{Code: returnCode}, ""
+	}
+
+	message = strings.TrimSpace(lines[1])
+	code := strings.TrimSpace(strings.TrimPrefix(message, "return code:"))
+	if _, err := strconv.Atoi(code); err != nil {
+		code = "-1"
+	}
+	result = LoadResult{Code: code}
+	if len(lines) > 2 {
+		result.Status, result.Body = parseResponseBody(lines[2:])
+	}
+	return returnCode, result, message
+}
+
+// parseResponseBody decodes key=value lines into a map. If any non-empty line is not
+// key=value shaped, the body is returned as raw text instead.
+func parseResponseBody(lines []string) (map[string]string, string) {
+	status := map[string]string{}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, strings.TrimSpace(strings.Join(lines, "\n"))
+		}
+		status[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	if len(status) == 0 {
+		return nil, ""
+	}
+	return status, ""
+}
+
+// exitedDuringAttach reports whether the target JVM is gone, so that socket failures
+// after a successful checkSocket can be told apart from protocol problems.
+// A JVM reached through a custom connection (e.g. a remote bridge) is not checked locally.
+func (jp *JvmProcess) exitedDuringAttach() bool {
+	if jp.connect != nil {
+		return false
+	}
+	exist, _ := pkg.PidExists(jp.Pid)
+	return !exist
+}
+
+// isPermissionError reports whether err was caused by EACCES or EPERM,
+// which on hardened hosts usually means a MAC policy or an ownership mismatch.
+func isPermissionError(err error) bool {
+	return errors.Is(err, syscall.EACCES) || errors.Is(err, syscall.EPERM)
+}
+
+// readAttachResponse reads the response until EOF. If maxSize is positive, a response
+// larger than maxSize bytes is rejected with ErrResponseTooLarge; 0 means unlimited.
+func readAttachResponse(conn net.Conn, pid int32, maxSize int) (resp string, err error) {
 	buf := make([]byte, 4096)
 	var data []byte
 	n := 0
 	for {
-		n, err = unix.Read(fd, buf)
+		n, err = conn.Read(buf)
 		if n > 0 {
 			data = append(data, buf[:n]...)
+			if maxSize > 0 && len(data) > maxSize {
+				return "", fmt.Errorf("attach response from process %v: %w (limit %d bytes)", pid, ErrResponseTooLarge, maxSize)
+			}
 		}
 		if err != nil {
 			if err == io.EOF {
+				err = nil
 				break
 			}
 			return "", fmt.Errorf("failed to read attach response from process %v: %v", pid, err.Error())
@@ -1,9 +1,18 @@
 package internal
 
 import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"os/user"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/XHao/jvmtool/pkg"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -36,7 +45,7 @@ func TestLoadAgent(t *testing.T) {
 		}
 		defer cleanup2()
 		err = jvmProc.loadAgent(agentPath, "")
-		assert.EqualError(t, err, "agent load failed, code 102: No agentmain method or agentmain failed")
+		assert.ErrorIs(t, err, ErrAgentMainFailed)
 	}
 
 	{
@@ -47,7 +56,7 @@ func TestLoadAgent(t *testing.T) {
 		}
 		defer cleanup2()
 		err = jvmProc.loadAgent(agentPath, "")
-		assert.EqualError(t, err, "agent load failed, code 100: Agent JAR not found or no Agent-Class attribute")
+		assert.ErrorIs(t, err, ErrAgentClassMissing)
 	}
 
 	cleanup()
@@ -59,6 +68,303 @@ func TestLoadAgent(t *testing.T) {
 		}
 		defer cleanup2()
 		err = jvmProc.loadAgent(agentPath, "")
-		assert.NotNil(t, err)
+		assert.ErrorIs(t, err, ErrJvmExited)
 	}
 }
+
+func TestLoadAgent_JvmExited(t *testing.T) {
+	origPidExists := pkg.PidExists
+	defer func() { pkg.PidExists = origPidExists }()
+	pkg.PidExists = func(pid int32) (bool, error) { return false, nil }
+
+	jvmProc := JvmProcess{Pid: 999999}
+	err := jvmProc.loadAgent("/tmp/agent.jar", "")
+	assert.ErrorIs(t, err, ErrJvmExited)
+}
+
+// TestRequest_PermissionDenied tests that a permission error keeps the original cause and path.
+func TestRequest_PermissionDenied(t *testing.T) {
+	cause := &os.PathError{Op: "dial", Path: "/tmp/.java_pid12345", Err: syscall.EACCES}
+	jvmProc := JvmProcess{Pid: 12345, connect: func(pid int32) (net.Conn, error) { return nil, cause }}
+	_, err := jvmProc.jcmd("VM.version")
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	assert.ErrorIs(t, err, syscall.EACCES)
+	assert.EqualError(t, err, "failed to connect to target process 12345: dial /tmp/.java_pid12345: permission denied; "+ErrPermissionDenied.Error())
+}
+
+func TestIsPermissionError(t *testing.T) {
+	assert.True(t, isPermissionError(syscall.EACCES))
+	assert.True(t, isPermissionError(syscall.EPERM))
+	assert.True(t, isPermissionError(&os.PathError{Op: "open", Path: "/tmp/.attach_pid1", Err: syscall.EACCES}))
+	assert.False(t, isPermissionError(syscall.ENOENT))
+	assert.False(t, isPermissionError(nil))
+}
+
+func TestLoadAgent_ConnectFunc(t *testing.T) {
+	jvmProc := JvmProcess{Pid: 12345, connect: fakeJvmConnect("0\n0\n")}
+	err := jvmProc.loadAgent("/tmp/agent.jar", "foo=bar")
+	assert.Nil(t, err)
+}
+
+func TestLoadAgent_ErrorCodes(t *testing.T) {
+	tests := map[string]error{
+		"0\n100\n": ErrAgentClassMissing,
+		"0\n101\n": ErrAgentClassPath,
+		"0\n102\n": ErrAgentMainFailed,
+	}
+	for resp, expected := range tests {
+		jvmProc := JvmProcess{Pid: 12345, connect: fakeJvmConnect(resp)}
+		err := jvmProc.loadAgent("/tmp/agent.jar", "")
+		assert.ErrorIs(t, err, expected)
+	}
+}
+
+func TestLoadAgent_ProtocolVersion(t *testing.T) {
+	for _, version := range []string{"", "2"} {
+		var request []byte
+		connect := func(pid int32) (net.Conn, error) {
+			client, server := net.Pipe()
+			go func() {
+				defer server.Close()
+				buf := make([]byte, 1)
+				for nul := 0; nul < 5; {
+					if _, err := server.Read(buf); err != nil {
+						return
+					}
+					request = append(request, buf[0])
+					if buf[0] == 0 {
+						nul++
+					}
+				}
+				server.Write([]byte("0\n0\n"))
+			}()
+			return client, nil
+		}
+		jvmProc := JvmProcess{Pid: 12345, ProtocolVersion: version, connect: connect}
+		assert.Nil(t, jvmProc.loadAgent("/tmp/agent.jar", ""))
+
+		expected := version
+		if expected == "" {
+			expected = defaultProtocolVersion
+		}
+		assert.Equal(t, expected+"\x00load\x00", string(request[:len(expected)+6]))
+	}
+}
+
+func TestJcmd(t *testing.T) {
+	jvmProc := JvmProcess{Pid: 12345, connect: fakeJvmConnect("0\nCommand executed successfully\n")}
+	output, err := jvmProc.jcmd("GC.run")
+	assert.Nil(t, err)
+	assert.Equal(t, "Command executed successfully\n", output)
+
+	jvmProc = JvmProcess{Pid: 12345, connect: fakeJvmConnect("1\nUnknown diagnostic command\n")}
+	_, err = jvmProc.jcmd("GC.nope")
+	assert.EqualError(t, err, "jcmd GC.nope failed, return code 1: Unknown diagnostic command")
+}
+
+func TestAttachPaths(t *testing.T) {
+	jvmProc := JvmProcess{Pid: 12345}
+	assert.Equal(t, os.TempDir()+"/.java_pid12345", jvmProc.socketPath())
+	assert.Equal(t, os.TempDir()+"/.attach_pid12345", jvmProc.attachFilePath())
+
+	jvmProc = JvmProcess{Pid: 12345, SocketDir: "/run/jvm", AttachFileDir: "/proc/12345/cwd"}
+	assert.Equal(t, "/run/jvm/.java_pid12345", jvmProc.socketPath())
+	assert.Equal(t, "/proc/12345/cwd/.attach_pid12345", jvmProc.attachFilePath())
+}
+
+func TestJvmProcess_MarshalJSON(t *testing.T) {
+	jp := JvmProcess{
+		Pid:            12345,
+		Cmd:            "java -XX:+UseG1GC com.example.App arg",
+		User:           user.User{Username: "alice", Uid: "1000", HomeDir: "/home/alice"},
+		mainClassOrJar: "com.example.App",
+		vmArgs:         "-XX:+UseG1GC ",
+		mainArgs:       "arg",
+		xxFlags:        []VMFlag{{Name: "UseG1GC", Value: "true"}},
+	}
+	data, err := json.Marshal(jp)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"pid":12345,"user":"alice","cmd":"java -XX:+UseG1GC com.example.App arg","mainClass":"com.example.App","vmArgs":"-XX:+UseG1GC","mainArgs":"arg","xxFlags":[{"name":"UseG1GC","value":"true"}]}`, string(data))
+}
+
+func TestLoadAgentResult_Body(t *testing.T) {
+	jvmProc := JvmProcess{Pid: 12345, connect: fakeJvmConnect("0\n0\nstate=started\nport = 9999\n")}
+	result, err := jvmProc.loadAgentResult("/tmp/agent.jar", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "0", result.Code)
+	assert.Equal(t, map[string]string{"state": "started", "port": "9999"}, result.Status)
+	assert.Equal(t, "", result.Body)
+
+	jvmProc = JvmProcess{Pid: 12345, connect: fakeJvmConnect("0\n0\nagent started\nstate=ok\n")}
+	result, err = jvmProc.loadAgentResult("/tmp/agent.jar", "")
+	assert.Nil(t, err)
+	assert.Nil(t, result.Status)
+	assert.Equal(t, "agent started\nstate=ok", result.Body)
+}
+
+func TestLoadAgentResult_UnknownCode(t *testing.T) {
+	resp := "0\nreturn code: 7\nagent refused: already loaded\n"
+	jvmProc := JvmProcess{Pid: 12345, connect: fakeJvmConnect(resp)}
+	result, err := jvmProc.loadAgentResult("/tmp/agent.jar", "")
+	assert.Equal(t, "7", result.Code)
+	var attachErr *AttachError
+	if assert.ErrorAs(t, err, &attachErr) {
+		assert.Equal(t, "7", attachErr.Code())
+		assert.Equal(t, resp, attachErr.Response())
+	}
+	assert.EqualError(t, err, `agent load failed, unknown code 7, response: "0\nreturn code: 7\nagent refused: already loaded\n"`)
+}
+
+func TestJcmd_MaxResponseSize(t *testing.T) {
+	resp := "0\n" + strings.Repeat("x", 10000)
+	jvmProc := JvmProcess{Pid: 12345, MaxResponseSize: 4096, connect: fakeJvmConnect(resp)}
+	_, err := jvmProc.jcmd("Thread.print")
+	assert.ErrorIs(t, err, ErrResponseTooLarge)
+
+	jvmProc = JvmProcess{Pid: 12345, MaxResponseSize: 0, connect: fakeJvmConnect(resp)}
+	output, err := jvmProc.jcmd("Thread.print")
+	assert.Nil(t, err)
+	assert.Equal(t, 10000, len(output))
+}
+
+func TestParseTriggerSignal(t *testing.T) {
+	for _, name := range []string{"", "QUIT", "SIGQUIT", "quit", "3"} {
+		sig, send, err := parseTriggerSignal(name)
+		assert.Nil(t, err)
+		assert.True(t, send)
+		assert.Equal(t, syscall.SIGQUIT, sig)
+	}
+	_, send, err := parseTriggerSignal("none")
+	assert.Nil(t, err)
+	assert.False(t, send)
+
+	_, _, err = parseTriggerSignal("USR1")
+	assert.ErrorContains(t, err, "only starts its attach listener on SIGQUIT")
+}
+
+func TestExecute_RequestLayout(t *testing.T) {
+	tests := []struct {
+		cmd      string
+		args     []string
+		expected string
+	}{
+		{cmd: "load", args: []string{"instrument", "false", "/tmp/agent.jar=a=1"}, expected: "1\x00load\x00instrument\x00false\x00/tmp/agent.jar=a=1\x00"},
+		{cmd: "jcmd", args: []string{"Thread.print -l"}, expected: "1\x00jcmd\x00Thread.print -l\x00\x00\x00"},
+		{cmd: "properties", expected: "1\x00properties\x00\x00\x00\x00"},
+		{cmd: "threaddump", args: []string{""}, expected: "1\x00threaddump\x00\x00\x00\x00"},
+	}
+	for _, tt := range tests {
+		var request []byte
+		jvmProc := JvmProcess{Pid: 12345, connect: recordingJvmConnect(&request, "0\n")}
+		_, err := jvmProc.execute(tt.cmd, tt.args...)
+		assert.Nil(t, err)
+		assert.Equal(t, tt.expected, string(request), tt.cmd)
+	}
+
+	jvmProc := JvmProcess{Pid: 12345, connect: fakeJvmConnect("0\n")}
+	_, err := jvmProc.execute("load", "a", "b", "c", "d")
+	assert.EqualError(t, err, "too many arguments for attach command load: 4")
+}
+
+func TestCheckSocket_PollInterval(t *testing.T) {
+	dir := t.TempDir()
+	jvmProc := JvmProcess{Pid: 12345, SocketDir: dir, AttachFileDir: dir, TriggerSignal: triggerSignalNone, PollInterval: 10 * time.Millisecond}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		os.WriteFile(jvmProc.socketPath(), nil, 0644)
+	}()
+
+	start := time.Now()
+	assert.Nil(t, jvmProc.checkSocket())
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	_, err := os.Stat(jvmProc.attachFilePath())
+	assert.True(t, os.IsNotExist(err), "expected the .attach_pid file to be removed")
+}
+
+func TestCheckSocket_Timeout(t *testing.T) {
+	dir := t.TempDir()
+	clock := time.Unix(0, 0)
+	var slept time.Duration
+	jvmProc := JvmProcess{
+		Pid: 12345, SocketDir: dir, AttachFileDir: dir, TriggerSignal: triggerSignalNone,
+		now:   func() time.Time { return clock },
+		sleep: func(d time.Duration) { clock = clock.Add(d); slept += d },
+	}
+
+	start := time.Now()
+	err := jvmProc.checkSocket()
+	assert.ErrorContains(t, err, "doesn't respond within 9000ms")
+	assert.Equal(t, attachTimeout, slept)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+// drippingJvmConnect returns a connectFunc whose server writes chunks with a pause in between,
+// recording in written how many chunks it managed to send.
+func drippingJvmConnect(chunks []string, written *atomic.Int32) connectFunc {
+	return func(pid int32) (net.Conn, error) {
+		client, server := net.Pipe()
+		go func() {
+			defer server.Close()
+			buf := make([]byte, 1)
+			for nul := 0; nul < 5; {
+				if _, err := server.Read(buf); err != nil {
+					return
+				}
+				if buf[0] == 0 {
+					nul++
+				}
+			}
+			for _, chunk := range chunks {
+				if _, err := server.Write([]byte(chunk)); err != nil {
+					return
+				}
+				written.Add(1)
+				time.Sleep(5 * time.Millisecond)
+			}
+		}()
+		return client, nil
+	}
+}
+
+func TestExecuteStream(t *testing.T) {
+	var written atomic.Int32
+	chunks := []string{"0\n", "line 1\n", "line", " 2\n", "line 3"}
+	jvmProc := JvmProcess{Pid: 12345, connect: drippingJvmConnect(chunks, &written)}
+	var lines []string
+	err := jvmProc.executeStream("jcmd", func(line string) error {
+		// each line is delivered before the rest of the response was written
+		if len(lines) == 1 {
+			assert.Less(t, written.Load(), int32(len(chunks)))
+		}
+		lines = append(lines, line)
+		return nil
+	}, "Thread.print")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"0", "line 1", "line 2", "line 3"}, lines)
+
+	// an error from the callback stops reading early
+	stop := errors.New("stop")
+	written.Store(0)
+	jvmProc = JvmProcess{Pid: 12345, connect: drippingJvmConnect(chunks, &written)}
+	err = jvmProc.executeStream("jcmd", func(line string) error { return stop }, "Thread.print")
+	assert.ErrorIs(t, err, stop)
+	assert.Less(t, written.Load(), int32(len(chunks)))
+
+	jvmProc = JvmProcess{Pid: 12345, MaxResponseSize: 8, connect: fakeJvmConnect("0\n" + strings.Repeat("x\n", 10))}
+	err = jvmProc.executeStream("jcmd", func(string) error { return nil }, "Thread.print")
+	assert.ErrorIs(t, err, ErrResponseTooLarge)
+}
+
+func TestJcmdStream(t *testing.T) {
+	var lines []string
+	jvmProc := JvmProcess{Pid: 12345, connect: fakeJvmConnect("0\nline 1\nline 2\n")}
+	assert.Nil(t, jvmProc.jcmdStream("Thread.print", func(line string) error {
+		lines = append(lines, line)
+		return nil
+	}))
+	assert.Equal(t, []string{"line 1", "line 2"}, lines)
+
+	jvmProc = JvmProcess{Pid: 12345, connect: fakeJvmConnect("1\nUnknown diagnostic command\n")}
+	err := jvmProc.jcmdStream("GC.nope", func(string) error { return nil })
+	assert.EqualError(t, err, "jcmd GC.nope failed, return code 1: Unknown diagnostic command")
+}
@@ -0,0 +1,77 @@
+//go:build unix
+
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecute_UnixSocket(t *testing.T) {
+	server, cleanup, err := startAttachServer(12345, cannedResponse("0", "Command executed successfully\n"))
+	if err != nil {
+		t.Fatalf("failed to start attach server: %v", err)
+	}
+	defer cleanup()
+
+	output, err := server.jvmProcess().jcmd("GC.run")
+	assert.Nil(t, err)
+	assert.Equal(t, "Command executed successfully\n", output)
+	assert.Equal(t, [][]string{{defaultProtocolVersion, "jcmd", "GC.run", "", ""}}, server.received())
+}
+
+func TestLoadAgent_MalformedResponses(t *testing.T) {
+	tests := []struct {
+		name     string
+		resp     string
+		code     string
+		expected string
+	}{
+		{name: "single line success", resp: "0\n", code: "0"},
+		{name: "single line without newline", resp: "0", code: "0"},
+		{name: "empty second line", resp: "0\n\n", code: "0"},
+		{name: "single line failure", resp: "1\n", code: "1", expected: "agent load failed, return code: 1"},
+		{name: "return code prefix", resp: "0\nreturn code: 0\n", code: "0"},
+		{name: "return code prefix without value", resp: "0\nreturn code:\n", code: "-1", expected: "return code:"},
+		{name: "negative code", resp: "0\n-1\n", code: "-1", expected: "-1"},
+		{name: "message", resp: "0\ncom.sun.tools.attach.AgentLoadException: boom\n", code: "-1", expected: "com.sun.tools.attach.AgentLoadException: boom"},
+		{name: "multi-line output", resp: "0\n0\nstarted\non port 9999\n", code: "0"},
+		{name: "blank response", resp: "\n", expected: "agent load failed, malformed response: \"\\n\""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, cleanup, err := startAttachServer(12345, func(request []string) string { return tt.resp })
+			if err != nil {
+				t.Fatalf("failed to start attach server: %v", err)
+			}
+			defer cleanup()
+
+			result, err := server.jvmProcess().loadAgentResult("/tmp/agent.jar", "")
+			if tt.expected == "" {
+				assert.Nil(t, err)
+			} else {
+				assert.EqualError(t, err, tt.expected)
+			}
+			assert.Equal(t, tt.code, result.Code)
+		})
+	}
+}
+
+func TestLoadAgent_MultiLineParams(t *testing.T) {
+	// the server echoes the agent argument back as agent output
+	server, cleanup, err := startAttachServer(12345, func(request []string) string {
+		return "0\n0\n" + request[4]
+	})
+	if err != nil {
+		t.Fatalf("failed to start attach server: %v", err)
+	}
+	defer cleanup()
+
+	params := "host=a\nport=1\r\n\tindented"
+	result, err := server.jvmProcess().loadAgentResult("/tmp/agent.jar", params)
+	assert.Nil(t, err)
+	assert.Equal(t, "0", result.Code)
+	assert.Equal(t, "/tmp/agent.jar="+params, server.received()[0][4])
+	assert.Equal(t, []string{defaultProtocolVersion, "load", "instrument", "false"}, server.received()[0][:4])
+}
@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/XHao/jvmtool/pkg"
+)
+
+// Exit codes of the listener command.
+const (
+	listenerPresent = 0
+	listenerError   = 1
+	listenerAbsent  = 2
+	listenerGone    = 3
+)
+
+type ListenerOption struct {
+	Pid       string
+	SocketDir string    // directory of the .java_pid socket
+	Out       io.Writer // results, os.Stdout if nil
+	ErrOut    io.Writer // errors, os.Stderr if nil
+}
+
+// ParseListenerFlags parses flags for the "listener" command and returns the corresponding ListenerOption.
+func ParseListenerFlags(args []string) (ListenerOption, error) {
+	listenerFlagSet := flag.NewFlagSet("listener", flag.ContinueOnError)
+	pid := listenerFlagSet.String("pid", "", "specify the pid of the Java process to check")
+	socketDir := listenerFlagSet.String("socket-dir", "", "specify the directory of the attach socket")
+	if err := listenerFlagSet.Parse(args); err != nil {
+		return ListenerOption{}, err
+	}
+	return ListenerOption{
+		Pid:       *pid,
+		SocketDir: *socketDir,
+	}, nil
+}
+
+// ListenerValidate validates the ListenerOption fields.
+func (opt *ListenerOption) ListenerValidate() error {
+	if opt.Pid == "" {
+		return ErrPidRequired
+	}
+	if pid, err := strconv.Atoi(opt.Pid); err != nil || pid <= 0 {
+		return fmt.Errorf("invalid pid %q", opt.Pid)
+	}
+	return nil
+}
+
+// Listener reports whether the attach listener of the JVM is already running, i.e. whether it was
+// attached to earlier in its lifetime. Unlike an attach, it only looks for the .java_pid socket:
+// no .attach_pid file is created and no signal is sent. The exit code is 0 if the listener is
+// present, 2 if it is absent and 3 if the process is gone.
+func Listener(option ListenerOption) int {
+	o := newOutput(option.Out, option.ErrOut)
+	if err := option.ListenerValidate(); err != nil {
+		o.printError(err)
+		return listenerError
+	}
+
+	jp := &JvmProcess{Pid: toInt32(option.Pid), SocketDir: option.SocketDir}
+	if exist, _ := pkg.PidExists(jp.Pid); !exist {
+		o.print(fmt.Sprintf("process %d is gone", jp.Pid))
+		return listenerGone
+	}
+	info, err := os.Stat(jp.socketPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			o.printError(fmt.Errorf("cannot check attach listener socket %s: %v", jp.socketPath(), err))
+			return listenerError
+		}
+		o.print(fmt.Sprintf("attach listener of process %d is absent", jp.Pid))
+		return listenerAbsent
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		o.printError(fmt.Errorf("%s is not a socket", jp.socketPath()))
+		return listenerError
+	}
+	o.print(fmt.Sprintf("attach listener of process %d is present: %s", jp.Pid, jp.socketPath()))
+	return listenerPresent
+}
@@ -0,0 +1,35 @@
+package internal
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListener(t *testing.T) {
+	dir, err := os.MkdirTemp("", "listener")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	pid := strconv.Itoa(os.Getpid())
+
+	assert.Equal(t, listenerAbsent, Listener(ListenerOption{Pid: pid, SocketDir: dir}))
+	entries, _ := os.ReadDir(dir)
+	assert.Empty(t, entries, "expected no .attach_pid file to be created")
+
+	l, err := net.Listen("unix", filepath.Join(dir, ".java_pid"+pid))
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+	assert.Equal(t, listenerPresent, Listener(ListenerOption{Pid: pid, SocketDir: dir}))
+
+	assert.Equal(t, listenerGone, Listener(ListenerOption{Pid: "999999", SocketDir: dir}))
+	assert.Equal(t, listenerError, Listener(ListenerOption{Pid: "abc"}))
+	assert.Equal(t, listenerError, Listener(ListenerOption{}))
+}
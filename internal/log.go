@@ -1,6 +1,11 @@
 package internal
 
-import "os"
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
 
 // globalLogger is the global logger instance used by the log and logInit functions.
 var globalLogger *Logger
@@ -20,9 +25,30 @@ var log = func(msg string) {
 	globalLogger.Print(msg)
 }
 
+// logInfo logs an informational progress message, which is dropped when the global logger is quiet.
+func logInfo(msg string) {
+	if globalLogger != nil && globalLogger.quiet {
+		return
+	}
+	log(msg)
+}
+
+// setLogQuiet makes the global logger drop informational messages, or print them again,
+// and returns a function restoring the previous setting.
+func setLogQuiet(quiet bool) (restore func()) {
+	if globalLogger == nil {
+		globalLogger = NewLogger(nil)
+	}
+	logger, previous := globalLogger, globalLogger.quiet
+	logger.quiet = quiet
+	return func() { logger.quiet = previous }
+}
+
 // Logger is a configurable logging utility. By default, it outputs to the console in a pretty format.
+// A quiet Logger drops the messages logged with logInfo.
 type Logger struct {
 	outputFunc func(msg string)
+	quiet      bool
 }
 
 // NewLogger creates a new Logger with the specified output function.
@@ -41,21 +67,66 @@ func (l *Logger) Print(msg string) {
 	l.outputFunc(msg)
 }
 
+// output is where a command writes its results and its errors. Commands take the writers from
+// the Out and ErrOut fields of their option, so that they can be captured into a buffer or
+// embedded into another program. Progress and other diagnostics still go to the logger.
+type output struct {
+	out    io.Writer
+	errOut io.Writer
+}
+
+// newOutput returns the output of a command, defaulting to os.Stdout and os.Stderr for nil writers.
+func newOutput(out io.Writer, errOut io.Writer) *output {
+	if out == nil {
+		out = os.Stdout
+	}
+	if errOut == nil {
+		errOut = os.Stderr
+	}
+	return &output{out: out, errOut: errOut}
+}
+
+// print writes msg as a line of the command's result.
+func (o *output) print(msg string) {
+	fmt.Fprintln(o.out, msg)
+}
+
+// warn writes msg as a warning line to the error writer.
+func (o *output) warn(msg string) {
+	fmt.Fprintln(o.errOut, "warning: "+msg)
+}
+
 // FileOutputFunc returns an output function that writes log messages to the specified file path, overwriting the file if it exists.
+// Each message replaces the file atomically, so readers never see a partial message.
 func FileOutputFunc(filePath string) func(msg string) {
 	return func(msg string) {
-		f, err := openLogFile(filePath)
-		if err != nil {
+		if err := writeFileAtomic(filePath, []byte(msg+"\n")); err != nil {
 			println("Logger error:", err.Error())
 			println(msg)
-			return
 		}
-		defer f.Close()
-		f.WriteString(msg + "\n")
 	}
 }
 
-// openLogFile opens or creates the log file in write-only mode, truncating it if it already exists.
-func openLogFile(filePath string) (*os.File, error) {
-	return os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+// writeFileAtomic writes data to a temp file next to filePath and renames it into place,
+// so that a reader sees either the previous or the complete new content.
+func writeFileAtomic(filePath string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, filePath)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+	}
+	return err
 }
@@ -70,15 +70,13 @@ func TestFileOutputFunc_OverwriteFile(t *testing.T) {
 	}
 }
 
-// TestOpenLogFile_CreatesFile tests that openLogFile creates a new file if it does not exist.
-func TestOpenLogFile_CreatesFile(t *testing.T) {
+// TestWriteFileAtomic_CreatesFile tests that writeFileAtomic creates the file and leaves no temp file behind.
+func TestWriteFileAtomic_CreatesFile(t *testing.T) {
 	dir := t.TempDir()
 	logFile := filepath.Join(dir, "newfile.log")
-	f, err := openLogFile(logFile)
-	if err != nil {
-		t.Fatalf("openLogFile failed: %v", err)
+	if err := writeFileAtomic(logFile, []byte("content")); err != nil {
+		t.Fatalf("writeFileAtomic failed: %v", err)
 	}
-	defer f.Close()
 	info, err := os.Stat(logFile)
 	if err != nil {
 		t.Fatalf("Expected file to exist: %v", err)
@@ -86,4 +84,70 @@ func TestOpenLogFile_CreatesFile(t *testing.T) {
 	if info.IsDir() {
 		t.Errorf("Expected a file, got a directory")
 	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("Expected mode 0644, got %v", info.Mode().Perm())
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected only the target file, got %v", entries)
+	}
+}
+
+// TestWriteFileAtomic_MissingDir tests that writeFileAtomic fails without touching anything when the directory is missing.
+func TestWriteFileAtomic_MissingDir(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "missing", "out.log")
+	if err := writeFileAtomic(logFile, []byte("content")); err == nil {
+		t.Errorf("Expected an error for a missing directory")
+	}
+}
+
+// TestLogInfo_Quiet tests that a quiet logger drops informational messages only.
+func TestLogInfo_Quiet(t *testing.T) {
+	restore, getLogs, clearLogs := captureLogs()
+	defer restore()
+
+	jvmProc := JvmProcess{Pid: 12345, connect: fakeJvmConnect("0\n0\n")}
+	if err := jvmProc.loadAgent("/tmp/agent.jar", ""); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if logs := getLogs(); len(logs) != 2 {
+		t.Errorf("expected the progress messages, got %v", logs)
+	}
+
+	clearLogs()
+	restoreQuiet := setLogQuiet(true)
+	if err := jvmProc.loadAgent("/tmp/agent.jar", ""); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	log("result")
+	restoreQuiet()
+	logInfo("progress")
+	expected := []string{"result", "progress"}
+	if logs := getLogs(); strings.Join(logs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected %v, got %v", expected, logs)
+	}
+}
+
+// TestNewOutput tests that commands write results and errors to the writers of their option.
+func TestNewOutput(t *testing.T) {
+	o := newOutput(nil, nil)
+	if o.out != os.Stdout || o.errOut != os.Stderr {
+		t.Errorf("expected os.Stdout and os.Stderr by default")
+	}
+
+	var out, errOut strings.Builder
+	if code := PrintVersion(VersionOption{Json: true, Out: &out, ErrOut: &errOut}); code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+	if !strings.HasPrefix(out.String(), "{") || errOut.Len() != 0 {
+		t.Errorf("unexpected output: %q, errors: %q", out.String(), errOut.String())
+	}
+
+	out.Reset()
+	if code := Prop(PropOption{Name: "java.home", Out: &out, ErrOut: &errOut}); code != 1 {
+		t.Fatalf("expected exit code 1, got %d", code)
+	}
+	if out.Len() != 0 || errOut.String() != ErrPidRequired.Error()+"\n" {
+		t.Errorf("unexpected output: %q, errors: %q", out.String(), errOut.String())
+	}
 }
@@ -0,0 +1,102 @@
+//go:build unix
+
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// attachMockServer is a fake HotSpot attach listener on a real unix socket at <dir>/.java_pid<pid>.
+// It lets the attach protocol be exercised end to end without a JVM.
+type attachMockServer struct {
+	dir      string
+	pid      int32
+	listener net.Listener
+	respond  func(request []string) string
+
+	mu       sync.Mutex
+	requests [][]string
+}
+
+// startAttachServer listens on a .java_pid socket in a fresh temp dir and answers every request
+// with respond(request), where request holds the protocol version, the command and its arguments.
+func startAttachServer(pid int32, respond func(request []string) string) (*attachMockServer, func(), error) {
+	// unix socket paths are limited to ~100 bytes, so avoid deeply nested test temp dirs
+	dir, err := os.MkdirTemp("", "attach")
+	if err != nil {
+		return nil, nil, err
+	}
+	listener, err := net.Listen("unix", filepath.Join(dir, fmt.Sprintf(".java_pid%d", pid)))
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, nil, err
+	}
+	server := &attachMockServer{dir: dir, pid: pid, listener: listener, respond: respond}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		server.serve()
+	}()
+
+	cleanup := func() {
+		listener.Close()
+		wg.Wait()
+		os.RemoveAll(dir)
+	}
+	return server, cleanup, nil
+}
+
+// cannedResponse returns a respond func replying with the return code and body of a HotSpot response.
+func cannedResponse(code string, body string) func(request []string) string {
+	return func(request []string) string {
+		return code + "\n" + body
+	}
+}
+
+// jvmProcess returns a JvmProcess that reaches this server through its socket dir.
+func (s *attachMockServer) jvmProcess() *JvmProcess {
+	return &JvmProcess{Pid: s.pid, SocketDir: s.dir}
+}
+
+// received returns the requests received so far.
+func (s *attachMockServer) received() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]string{}, s.requests...)
+}
+
+// serve accepts connections until the listener is closed, handling one request per connection as HotSpot does.
+func (s *attachMockServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.handle(conn)
+	}
+}
+
+// handle reads the NUL-delimited request fields and writes the response.
+func (s *attachMockServer) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	request := []string{}
+	for len(request) < 2+attachArgCount {
+		field, err := reader.ReadString(0)
+		if err != nil {
+			return
+		}
+		request = append(request, strings.TrimSuffix(field, "\x00"))
+	}
+	s.mu.Lock()
+	s.requests = append(s.requests, request)
+	s.mu.Unlock()
+	conn.Write([]byte(s.respond(request)))
+}
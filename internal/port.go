@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/XHao/jvmtool/pkg"
+	"github.com/shirou/gopsutil/net"
+)
+
+// ListeningPidsProvider returns the pids of the processes listening on a TCP port. A pid of 0
+// stands for a listener whose process cannot be seen, e.g. one of another user without root.
+// It is a variable so that tests can replace it.
+var ListeningPidsProvider = func(port uint32) ([]int32, error) {
+	conns, err := net.Connections("tcp")
+	if err != nil {
+		return nil, err
+	}
+	pids := []int32{}
+	for _, conn := range conns {
+		if conn.Status == "LISTEN" && conn.Laddr.Port == port {
+			pids = append(pids, conn.Pid)
+		}
+	}
+	return pids, nil
+}
+
+// findPidByPort returns the pid of the only Java process listening on the TCP port.
+func findPidByPort(port int) (string, error) {
+	if port <= 0 || port > 65535 {
+		return "", fmt.Errorf("invalid port %d", port)
+	}
+	pids, err := ListeningPidsProvider(uint32(port))
+	if err != nil {
+		return "", fmt.Errorf("cannot list listening sockets: %v", err)
+	}
+	seen := map[int32]bool{}
+	unknown := false
+	for _, pid := range pids {
+		if pid == 0 {
+			unknown = true
+		} else {
+			seen[pid] = true
+		}
+	}
+	if len(seen) == 0 {
+		if unknown {
+			return "", fmt.Errorf("the process listening on port %d is not visible, run as its owner or root", port)
+		}
+		return "", fmt.Errorf("no process listens on port %d", port)
+	}
+	// SO_REUSEPORT or a forked listener can share the port
+	if len(seen) > 1 {
+		found := make([]int, 0, len(seen))
+		for pid := range seen {
+			found = append(found, int(pid))
+		}
+		sort.Ints(found)
+		candidates := make([]string, 0, len(found))
+		for _, pid := range found {
+			candidates = append(candidates, strconv.Itoa(pid))
+		}
+		return "", fmt.Errorf("multiple processes listen on port %d: %s", port, strings.Join(candidates, ", "))
+	}
+	for pid := range seen {
+		if !hasHsperfdata(strconv.Itoa(int(pid))) {
+			return "", fmt.Errorf("process %d listening on port %d is not a Java process", pid, port)
+		}
+		return strconv.Itoa(int(pid)), nil
+	}
+	return "", nil
+}
+
+// hasHsperfdata reports whether pid has an hsperfdata file under any user's directory.
+func hasHsperfdata(pid string) bool {
+	users, err := hsperfdataUsers()
+	if err != nil {
+		return false
+	}
+	for _, owner := range users {
+		if pkg.PathExists(GetHsperfdataPath(owner, pid)) {
+			return true
+		}
+	}
+	return false
+}
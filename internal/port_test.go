@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"testing"
+)
+
+// TestFindPidByPort tests resolving the Java process listening on a port.
+func TestFindPidByPort(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	_, cleanup, err := prepareHsperfdataFile("someone", 4242)
+	if err != nil {
+		t.Fatalf("failed to prepare hsperfdata file: %v", err)
+	}
+	defer cleanup()
+
+	listeners := map[uint32][]int32{
+		8080: {4242, 4242}, // IPv4 and IPv6 sockets of the same process
+		8081: {4343},
+		8082: {4242, 4343},
+		8083: {0},
+	}
+	orig := ListeningPidsProvider
+	defer func() { ListeningPidsProvider = orig }()
+	ListeningPidsProvider = func(port uint32) ([]int32, error) {
+		return listeners[port], nil
+	}
+
+	if pid, err := findPidByPort(8080); err != nil || pid != "4242" {
+		t.Errorf("expected pid 4242, got %s, %v", pid, err)
+	}
+	tests := []struct {
+		port     int
+		expected string
+	}{
+		{8081, "process 4343 listening on port 8081 is not a Java process"},
+		{8082, "multiple processes listen on port 8082: 4242, 4343"},
+		{8083, "the process listening on port 8083 is not visible, run as its owner or root"},
+		{9090, "no process listens on port 9090"},
+		{70000, "invalid port 70000"},
+	}
+	for _, tt := range tests {
+		if _, err := findPidByPort(tt.port); err == nil || err.Error() != tt.expected {
+			t.Errorf("port %d: expected error %q, got: %v", tt.port, tt.expected, err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/XHao/jvmtool/pkg"
+)
+
+// profilerAsync selects async-profiler, loaded as a native JVMTI agent.
+// @see https://github.com/async-profiler/async-profiler
+const profilerAsync = "async"
+
+// defaultAsyncProfilerArgs starts CPU sampling until stopped with "-args stop,file=...".
+const defaultAsyncProfilerArgs = "start,event=cpu"
+
+type ProfileOption struct {
+	User     string
+	Pid      string
+	Profiler string    // -profiler
+	Lib      string    // path to the profiler library
+	Args     string    // profiler options, e.g. "start,event=cpu,file=/tmp/profile.html"
+	Out      io.Writer // results, os.Stdout if nil
+	ErrOut   io.Writer // errors, os.Stderr if nil
+}
+
+// ParseProfileFlags parses flags for the "profile" command and returns the corresponding ProfileOption.
+func ParseProfileFlags(args []string) (ProfileOption, error) {
+	profileFlagSet := flag.NewFlagSet("profile", flag.ContinueOnError)
+	user := profileFlagSet.String("user", "", "specify the user owning the Java process")
+	pid := profileFlagSet.String("pid", "", "specify the pid of the Java process to profile")
+	profiler := profileFlagSet.String("profiler", profilerAsync, "specify the profiler, currently only async")
+	lib := profileFlagSet.String("lib", "", "specify the path to the profiler library, e.g. libasyncProfiler.so")
+	profilerArgs := profileFlagSet.String("args", defaultAsyncProfilerArgs, "specify the comma-separated profiler options")
+	if err := profileFlagSet.Parse(args); err != nil {
+		return ProfileOption{}, err
+	}
+	return ProfileOption{
+		User:     *user,
+		Pid:      *pid,
+		Profiler: *profiler,
+		Lib:      *lib,
+		Args:     *profilerArgs,
+	}, nil
+}
+
+// ProfileValidate validates the ProfileOption fields and makes Lib absolute,
+// as the JVM resolves a relative library against its own working directory.
+func (opt *ProfileOption) ProfileValidate() error {
+	if opt.Profiler != profilerAsync {
+		return fmt.Errorf("unsupported profiler %q, only %q is supported", opt.Profiler, profilerAsync)
+	}
+	if opt.Lib == "" {
+		return errors.New("lib is required")
+	}
+	opt.Args = strings.TrimSpace(opt.Args)
+	if opt.Args == "" {
+		return errors.New("args is required")
+	}
+	if strings.ContainsRune(opt.Lib+opt.Args, 0) {
+		return errors.New("lib and args must not contain NUL bytes")
+	}
+	lib, err := filepath.Abs(opt.Lib)
+	if err != nil {
+		return fmt.Errorf("cannot resolve lib path: %v", err)
+	}
+	if !pkg.PathExists(lib) {
+		return fmt.Errorf("profiler library %s does not exist", lib)
+	}
+	opt.Lib = lib
+	if err := checkAgentDir(opt.Lib); err != nil {
+		return err
+	}
+	username, err := validateTarget(opt.User, opt.Pid)
+	if err != nil {
+		return err
+	}
+	opt.User = username
+	return nil
+}
+
+// Profile loads the profiler library into the target JVM with the given options, e.g. to start
+// or stop async-profiler, and prints the profiler's response.
+func Profile(option ProfileOption) int {
+	o := newOutput(option.Out, option.ErrOut)
+	if err := option.ProfileValidate(); err != nil {
+		o.printError(err)
+		return 1
+	}
+
+	jp := &JvmProcess{
+		Pid: toInt32(option.Pid),
+	}
+	if err := jp.checkSocket(); err != nil {
+		o.printError(err)
+		return 1
+	}
+
+	err := jp.loadProfiler(option.Lib, option.Args, func(line string) error {
+		o.print(line)
+		return nil
+	})
+	if err != nil {
+		o.printError(err)
+		return 1
+	}
+	return 0
+}
+
+// loadProfiler sends "load <lib> true <args>" and passes each line of the profiler's output to
+// onOutput as it arrives, verbatim. A non-zero agent return code means Agent_OnAttach failed;
+// the output is still passed on, as it usually explains why.
+func (jp *JvmProcess) loadProfiler(lib string, args string, onOutput func(line string) error) error {
+	logInfo("waiting for attach to complete...")
+	var header []string
+	err := jp.executeStream("load", func(line string) error {
+		// the attach and the agent return codes come before the output
+		if len(header) < 2 {
+			header = append(header, line)
+			return nil
+		}
+		return onOutput(line)
+	}, lib, "true", args)
+	if err != nil {
+		return err
+	}
+
+	returnCode, result, message := parseLoadResponse(strings.Join(header, "\n"))
+	if returnCode == "" {
+		return fmt.Errorf("agent load failed, malformed response: %q", strings.Join(header, "\n"))
+	}
+	if returnCode != "0" {
+		return fmt.Errorf("agent load failed, return code: %s", returnCode)
+	}
+	if result.Code != "0" {
+		if result.Code == "-1" {
+			return fmt.Errorf("profiler failed: %s", message)
+		}
+		return fmt.Errorf("profiler failed, return code %s", result.Code)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfileValidate(t *testing.T) {
+	lib := filepath.Join(t.TempDir(), "libasyncProfiler.so")
+	if err := os.WriteFile(lib, nil, 0644); err != nil {
+		t.Fatalf("failed to create lib: %v", err)
+	}
+
+	opt := ProfileOption{Profiler: "jfr", Lib: lib, Args: defaultAsyncProfilerArgs, Pid: "12345"}
+	assert.EqualError(t, opt.ProfileValidate(), `unsupported profiler "jfr", only "async" is supported`)
+
+	opt = ProfileOption{Profiler: profilerAsync, Args: defaultAsyncProfilerArgs, Pid: "12345"}
+	assert.EqualError(t, opt.ProfileValidate(), "lib is required")
+
+	opt = ProfileOption{Profiler: profilerAsync, Lib: lib, Args: " ", Pid: "12345"}
+	assert.EqualError(t, opt.ProfileValidate(), "args is required")
+
+	opt = ProfileOption{Profiler: profilerAsync, Lib: lib + ".missing", Args: defaultAsyncProfilerArgs, Pid: "12345"}
+	assert.EqualError(t, opt.ProfileValidate(), "profiler library "+lib+".missing does not exist")
+
+	opt = ProfileOption{Profiler: profilerAsync, Lib: lib, Args: defaultAsyncProfilerArgs}
+	assert.ErrorIs(t, opt.ProfileValidate(), ErrPidRequired)
+}
+
+func TestLoadProfiler(t *testing.T) {
+	restore, _, _ := captureLogs()
+	defer restore()
+
+	var request []byte
+	var output []string
+	collect := func(line string) error {
+		output = append(output, line)
+		return nil
+	}
+	jvmProc := JvmProcess{Pid: 12345, connect: recordingJvmConnect(&request, "0\n0\nProfiling started\n")}
+	err := jvmProc.loadProfiler("/opt/async-profiler/lib/libasyncProfiler.so", "start,event=cpu", collect)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Profiling started"}, output)
+	assert.Equal(t, defaultProtocolVersion+"\x00load\x00/opt/async-profiler/lib/libasyncProfiler.so\x00true\x00start,event=cpu\x00", string(request))
+
+	// key=value output keeps the profiler's own line order
+	output = nil
+	jvmProc = JvmProcess{Pid: 12345, connect: fakeJvmConnect("0\n0\nstate=running\nevent=cpu\n")}
+	assert.Nil(t, jvmProc.loadProfiler("/opt/async-profiler/lib/libasyncProfiler.so", "status", collect))
+	assert.Equal(t, []string{"state=running", "event=cpu"}, output)
+
+	output = nil
+	jvmProc = JvmProcess{Pid: 12345, connect: fakeJvmConnect("0\n200\nunknown event nope\n")}
+	err = jvmProc.loadProfiler("/opt/async-profiler/lib/libasyncProfiler.so", "start,event=nope", collect)
+	assert.EqualError(t, err, "profiler failed, return code 200")
+	assert.Equal(t, []string{"unknown event nope"}, output)
+
+	jvmProc = JvmProcess{Pid: 12345, connect: fakeJvmConnect("0\nCould not load library\n")}
+	err = jvmProc.loadProfiler("/opt/async-profiler/lib/libasyncProfiler.so", "start", collect)
+	assert.EqualError(t, err, "profiler failed: Could not load library")
+}
@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/XHao/jvmtool/pkg"
+)
+
+// formatPrometheus prints a single snapshot in the Prometheus text exposition format, for a
+// node-local exporter to shell out to.
+const formatPrometheus = "prometheus"
+
+// promFamily is a metric family of the Prometheus text exposition format.
+type promFamily struct {
+	name    string
+	help    string
+	typ     string // counter or gauge
+	samples []promSample
+}
+
+// promSample is one sample of a metric family, with labels as name/value pairs in output order.
+type promSample struct {
+	labels []string
+	value  string
+}
+
+// prometheusMetrics maps the numeric perfdata counters of a JVM to Prometheus metrics labeled
+// with pid. String counters are only used as label values, e.g. collector and space names.
+// @see jdk/src/jdk.jcmd/share/classes/sun/tools/jstat/resources/jstat_options
+func prometheusMetrics(pid string, perfData *pkg.PerfData) []string {
+	gcCount := &promFamily{name: "jvm_gc_collection_count", help: "Number of collections by the collector.", typ: "counter"}
+	gcSeconds := &promFamily{name: "jvm_gc_collection_seconds", help: "Time spent in collections by the collector.", typ: "counter"}
+	spaceUsed := &promFamily{name: "jvm_memory_space_used_bytes", help: "Bytes used in the memory space.", typ: "gauge"}
+	spaceCapacity := &promFamily{name: "jvm_memory_space_capacity_bytes", help: "Bytes committed to the memory space.", typ: "gauge"}
+	threads := &promFamily{name: "jvm_threads_live", help: "Number of live threads.", typ: "gauge"}
+	classes := &promFamily{name: "jvm_classes_loaded", help: "Number of live loaded classes.", typ: "gauge"}
+	uptime := &promFamily{name: "jvm_uptime_seconds", help: "Time since the JVM started.", typ: "gauge"}
+
+	frequency, _ := perfData.Long("sun.os.hrt.frequency")
+	names := make([]string, 0, len(perfData.Counters))
+	for name := range perfData.Counters {
+		names = append(names, name)
+	}
+	// counter names sort by collector, generation and space index, each below 10 in HotSpot
+	sort.Strings(names)
+	for _, name := range names {
+		counter := perfData.Counters[name]
+		if counter.IsString {
+			continue
+		}
+		parts := strings.Split(name, ".")
+		switch {
+		case len(parts) == 5 && strings.HasPrefix(name, "sun.gc.collector."):
+			collector := perfDataLabel(perfData, "sun.gc.collector."+parts[3]+".name", parts[3])
+			switch parts[4] {
+			case "invocations":
+				gcCount.add(strconv.FormatInt(counter.Long, 10), "pid", pid, "collector", collector)
+			case "time":
+				if frequency > 0 {
+					gcSeconds.add(promFloat(float64(counter.Long)/float64(frequency)), "pid", pid, "collector", collector)
+				}
+			}
+		case len(parts) == 7 && strings.HasPrefix(name, "sun.gc.generation.") && parts[4] == "space":
+			space := perfDataLabel(perfData, strings.Join(parts[:6], ".")+".name", parts[3]+"."+parts[5])
+			switch parts[6] {
+			case "used":
+				spaceUsed.add(strconv.FormatInt(counter.Long, 10), "pid", pid, "space", space)
+			case "capacity":
+				spaceCapacity.add(strconv.FormatInt(counter.Long, 10), "pid", pid, "space", space)
+			}
+		case name == "sun.gc.metaspace.used":
+			spaceUsed.add(strconv.FormatInt(counter.Long, 10), "pid", pid, "space", "metaspace")
+		case name == "sun.gc.metaspace.capacity":
+			spaceCapacity.add(strconv.FormatInt(counter.Long, 10), "pid", pid, "space", "metaspace")
+		case name == "java.threads.live":
+			threads.add(strconv.FormatInt(counter.Long, 10), "pid", pid)
+		case name == "sun.os.hrt.ticks":
+			if frequency > 0 {
+				uptime.add(promFloat(float64(counter.Long)/float64(frequency)), "pid", pid)
+			}
+		}
+	}
+	if live, ok := liveClasses(perfData); ok {
+		classes.add(strconv.FormatInt(live, 10), "pid", pid)
+	}
+
+	var lines []string
+	for _, family := range []*promFamily{gcCount, gcSeconds, spaceUsed, spaceCapacity, threads, classes, uptime} {
+		lines = append(lines, family.lines()...)
+	}
+	return lines
+}
+
+// add appends a sample with the given label name/value pairs.
+func (f *promFamily) add(value string, labels ...string) {
+	f.samples = append(f.samples, promSample{labels: labels, value: value})
+}
+
+// lines renders the family with its HELP and TYPE header, or nothing if it has no samples.
+func (f *promFamily) lines() []string {
+	if len(f.samples) == 0 {
+		return nil
+	}
+	lines := []string{
+		fmt.Sprintf("# HELP %s %s", f.name, f.help),
+		fmt.Sprintf("# TYPE %s %s", f.name, f.typ),
+	}
+	for _, s := range f.samples {
+		pairs := make([]string, 0, len(s.labels)/2)
+		for i := 0; i+1 < len(s.labels); i += 2 {
+			pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", s.labels[i], promEscape(s.labels[i+1])))
+		}
+		lines = append(lines, fmt.Sprintf("%s{%s} %s", f.name, strings.Join(pairs, ","), s.value))
+	}
+	return lines
+}
+
+// perfDataLabel returns the string counter name, or fallback if the JVM does not export it.
+func perfDataLabel(perfData *pkg.PerfData, name string, fallback string) string {
+	if value, ok := perfData.String(name); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+// promEscape escapes a label value as the text exposition format requires.
+func promEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// promFloat formats a sample value without exponent noise for whole numbers.
+func promFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/XHao/jvmtool/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	perfData := perfDataOf(map[string]int64{
+		"sun.os.hrt.frequency":                    1000000000,
+		"sun.os.hrt.ticks":                        90500000000,
+		"sun.gc.collector.0.invocations":          42,
+		"sun.gc.collector.0.time":                 1500000000,
+		"sun.gc.collector.1.invocations":          2,
+		"sun.gc.generation.0.space.0.used":        3 << 20,
+		"sun.gc.generation.0.space.0.capacity":    6 << 20,
+		"sun.gc.generation.1.space.0.used":        4 << 20,
+		"sun.gc.metaspace.used":                   1 << 20,
+		"java.threads.live":                       25,
+		"java.cls.loadedClasses":                  1000,
+		"java.cls.unloadedClasses":                100,
+		"sun.gc.generation.0.space.0.maxCapacity": 8 << 20,
+	})
+	for name, value := range map[string]string{
+		"sun.gc.collector.0.name":          "G1 Young",
+		"sun.gc.generation.0.space.0.name": "eden",
+		"sun.gc.generation.1.space.0.name": `old "tenured"`,
+		"java.property.java.version":       "17.0.2",
+	} {
+		perfData.Counters[name] = pkg.PerfCounter{Name: name, IsString: true, String: value}
+	}
+
+	assert.Equal(t, []string{
+		"# HELP jvm_gc_collection_count Number of collections by the collector.",
+		"# TYPE jvm_gc_collection_count counter",
+		`jvm_gc_collection_count{pid="12345",collector="G1 Young"} 42`,
+		`jvm_gc_collection_count{pid="12345",collector="1"} 2`,
+		"# HELP jvm_gc_collection_seconds Time spent in collections by the collector.",
+		"# TYPE jvm_gc_collection_seconds counter",
+		`jvm_gc_collection_seconds{pid="12345",collector="G1 Young"} 1.5`,
+		"# HELP jvm_memory_space_used_bytes Bytes used in the memory space.",
+		"# TYPE jvm_memory_space_used_bytes gauge",
+		`jvm_memory_space_used_bytes{pid="12345",space="eden"} 3145728`,
+		`jvm_memory_space_used_bytes{pid="12345",space="old \"tenured\""} 4194304`,
+		`jvm_memory_space_used_bytes{pid="12345",space="metaspace"} 1048576`,
+		"# HELP jvm_memory_space_capacity_bytes Bytes committed to the memory space.",
+		"# TYPE jvm_memory_space_capacity_bytes gauge",
+		`jvm_memory_space_capacity_bytes{pid="12345",space="eden"} 6291456`,
+		"# HELP jvm_threads_live Number of live threads.",
+		"# TYPE jvm_threads_live gauge",
+		`jvm_threads_live{pid="12345"} 25`,
+		"# HELP jvm_classes_loaded Number of live loaded classes.",
+		"# TYPE jvm_classes_loaded gauge",
+		`jvm_classes_loaded{pid="12345"} 900`,
+		"# HELP jvm_uptime_seconds Time since the JVM started.",
+		"# TYPE jvm_uptime_seconds gauge",
+		`jvm_uptime_seconds{pid="12345"} 90.5`,
+	}, prometheusMetrics("12345", perfData))
+
+	// families without samples are left out entirely
+	assert.Empty(t, prometheusMetrics("12345", perfDataOf(nil)))
+}
+
+func TestVmstat_Prometheus(t *testing.T) {
+	var out bytes.Buffer
+	origReader := vmstatReader
+	defer func() { vmstatReader = origReader }()
+	reads := 0
+	vmstatReader = func(path string) (*pkg.PerfData, error) {
+		reads++
+		return perfDataOf(map[string]int64{"java.threads.live": 25}), nil
+	}
+
+	option := VmstatOption{User: "alice", Pid: "12345", Format: formatPrometheus, Out: &out}
+	assert.Equal(t, 0, vmstat(context.Background(), option))
+	assert.Equal(t, 1, reads)
+	assert.Equal(t, `jvm_threads_live{pid="12345"} 25`, outputLines(&out)[len(outputLines(&out))-1])
+	for _, line := range outputLines(&out) {
+		assert.False(t, strings.HasPrefix(line, "  HEAP"), "unexpected table header")
+	}
+
+	opt := VmstatOption{Pid: "12345", Interval: defaultVmstatInterval, Format: "json"}
+	assert.EqualError(t, opt.VmstatValidate(), `unsupported format "json", only "prometheus" is supported`)
+}
@@ -0,0 +1,200 @@
+package internal
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type PropOption struct {
+	User   string
+	Pid    string
+	Name   string
+	Out    io.Writer // results, os.Stdout if nil
+	ErrOut io.Writer // errors, os.Stderr if nil
+}
+
+// ParsePropFlags parses flags for the "prop" command and returns the corresponding PropOption.
+func ParsePropFlags(args []string) (PropOption, error) {
+	propFlagSet := flag.NewFlagSet("prop", flag.ContinueOnError)
+	user := propFlagSet.String("user", "", "specify the user owning the Java process")
+	pid := propFlagSet.String("pid", "", "specify the pid of the Java process")
+	name := propFlagSet.String("name", "", "specify the system property to print, e.g. java.version")
+	if err := propFlagSet.Parse(args); err != nil {
+		return PropOption{}, err
+	}
+	return PropOption{
+		User: *user,
+		Pid:  *pid,
+		Name: *name,
+	}, nil
+}
+
+// ParseJavaHomeFlags parses flags for the "javahome" command, a shortcut for "prop -name java.home"
+// that tells which JDK installation a JVM runs from, whatever symlinks its executable path has.
+func ParseJavaHomeFlags(args []string) (PropOption, error) {
+	javaHomeFlagSet := flag.NewFlagSet("javahome", flag.ContinueOnError)
+	user := javaHomeFlagSet.String("user", "", "specify the user owning the Java process")
+	pid := javaHomeFlagSet.String("pid", "", "specify the pid of the Java process")
+	if err := javaHomeFlagSet.Parse(args); err != nil {
+		return PropOption{}, err
+	}
+	return PropOption{
+		User: *user,
+		Pid:  *pid,
+		Name: "java.home",
+	}, nil
+}
+
+// PropValidate validates the PropOption fields.
+func (opt *PropOption) PropValidate() error {
+	if opt.Name == "" {
+		return errors.New("name is required")
+	}
+	username, err := validateTarget(opt.User, opt.Pid)
+	if err != nil {
+		return err
+	}
+	opt.User = username
+	return nil
+}
+
+// Prop prints the value of a single system property of the target JVM.
+func Prop(option PropOption) int {
+	o := newOutput(option.Out, option.ErrOut)
+	if err := option.PropValidate(); err != nil {
+		o.printError(err)
+		return 1
+	}
+
+	jp := &JvmProcess{
+		Pid: toInt32(option.Pid),
+	}
+	if err := jp.checkSocket(); err != nil {
+		o.printError(err)
+		return 1
+	}
+
+	value, err := jp.getProperty(option.Name)
+	if err != nil {
+		o.printError(err)
+		return 1
+	}
+	o.print(value)
+	return 0
+}
+
+// getProperty returns the system property name of the JVM, or an error wrapping ErrPropertyNotFound.
+func (jp *JvmProcess) getProperty(name string) (string, error) {
+	props, err := jp.properties()
+	if err != nil {
+		return "", err
+	}
+	value, ok := props[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrPropertyNotFound, name)
+	}
+	return value, nil
+}
+
+// properties returns the system properties of the JVM through the "properties" attach command.
+func (jp *JvmProcess) properties() (map[string]string, error) {
+	resp, err := jp.execute("properties")
+	if err != nil {
+		return nil, err
+	}
+	code, output, _ := strings.Cut(resp, "\n")
+	if code != "0" {
+		return nil, fmt.Errorf("properties failed, return code %s: %s", code, strings.TrimSpace(output))
+	}
+	return parseProperties(output), nil
+}
+
+// parseProperties decodes the java.util.Properties text format written by Properties.store:
+// comment lines, backslash line continuations, '=', ':' or whitespace separators and escapes.
+func parseProperties(text string) map[string]string {
+	props := map[string]string{}
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimLeft(lines[i], " \t\f")
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+		// an odd number of trailing backslashes continues the logical line
+		for endsWithContinuation(line) && i+1 < len(lines) {
+			i++
+			line = line[:len(line)-1] + strings.TrimLeft(lines[i], " \t\f")
+		}
+		key, value := splitProperty(line)
+		props[unescapeProperty(key)] = unescapeProperty(value)
+	}
+	return props
+}
+
+// endsWithContinuation reports whether line ends with an odd number of backslashes.
+func endsWithContinuation(line string) bool {
+	n := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// splitProperty splits a logical line at the first unescaped separator.
+func splitProperty(line string) (string, string) {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '=', ':':
+			return line[:i], strings.TrimLeft(line[i+1:], " \t\f")
+		case ' ', '\t', '\f':
+			value := strings.TrimLeft(line[i:], " \t\f")
+			if value != "" && (value[0] == '=' || value[0] == ':') {
+				value = strings.TrimLeft(value[1:], " \t\f")
+			}
+			return line[:i], value
+		}
+	}
+	return line, ""
+}
+
+// unescapeProperty resolves the backslash escapes of a key or value, including \uXXXX.
+func unescapeProperty(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			sb.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			sb.WriteByte('\t')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'u':
+			if i+4 < len(s) {
+				if r, err := strconv.ParseUint(s[i+1:i+5], 16, 16); err == nil {
+					sb.WriteRune(rune(r))
+					i += 4
+					continue
+				}
+			}
+			sb.WriteByte('u')
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProperties(t *testing.T) {
+	text := "#Thu Jan 01 00:00:00 UTC 2026\n" +
+		"java.version=17.0.2\n" +
+		"user.timezone=Europe/Berlin\n" +
+		"path.separator=\\:\n" +
+		"line.separator=\\n\n" +
+		"java.home=/usr/lib/jvm/java-17\n" +
+		"key\\=with\\:seps : spaced value\n" +
+		"user.name=\\u00e9mile\n" +
+		"java.class.path=a.jar\\\n" +
+		"    \\:b.jar\n" +
+		"empty=\n"
+	props := parseProperties(text)
+	assert.Equal(t, "17.0.2", props["java.version"])
+	assert.Equal(t, "Europe/Berlin", props["user.timezone"])
+	assert.Equal(t, ":", props["path.separator"])
+	assert.Equal(t, "\n", props["line.separator"])
+	assert.Equal(t, "spaced value", props["key=with:seps"])
+	assert.Equal(t, "émile", props["user.name"])
+	assert.Equal(t, "a.jar:b.jar", props["java.class.path"])
+	assert.Equal(t, "", props["empty"])
+	assert.Len(t, props, 9)
+}
+
+func TestGetProperty(t *testing.T) {
+	resp := "0\n#Thu Jan 01 00:00:00 UTC 2026\njava.version=17.0.2\n"
+	jvmProc := JvmProcess{Pid: 12345, connect: fakeJvmConnect(resp)}
+	value, err := jvmProc.getProperty("java.version")
+	assert.Nil(t, err)
+	assert.Equal(t, "17.0.2", value)
+
+	jvmProc = JvmProcess{Pid: 12345, connect: fakeJvmConnect(resp)}
+	_, err = jvmProc.getProperty("user.timezone")
+	assert.ErrorIs(t, err, ErrPropertyNotFound)
+}
+
+func TestPropValidate(t *testing.T) {
+	opt := PropOption{Pid: "12345"}
+	assert.EqualError(t, opt.PropValidate(), "name is required")
+
+	opt = PropOption{Name: "java.version"}
+	assert.ErrorIs(t, opt.PropValidate(), ErrPidRequired)
+}
+
+func TestParseJavaHomeFlags(t *testing.T) {
+	opt, err := ParseJavaHomeFlags([]string{"-pid", "12345"})
+	assert.Nil(t, err)
+	assert.Equal(t, PropOption{Pid: "12345", Name: "java.home"}, opt)
+
+	_, err = ParseJavaHomeFlags([]string{"-name", "java.version"})
+	assert.NotNil(t, err)
+}
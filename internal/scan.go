@@ -0,0 +1,322 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/XHao/jvmtool/pkg"
+	"github.com/shirou/gopsutil/process"
+)
+
+// defaultScanTimeout bounds the time spent inspecting a single JVM.
+const defaultScanTimeout = 2 * time.Second
+
+type ScanOption struct {
+	User        string
+	All         bool          // -all
+	Json        bool          // -json
+	Timeout     time.Duration // -timeout-per-process
+	Concurrency int           // -concurrency
+	Out         io.Writer     // results, os.Stdout if nil
+	ErrOut      io.Writer     // errors, os.Stderr if nil
+}
+
+// ParseScanFlags parses flags for the "scan" command and returns the corresponding ScanOption.
+func ParseScanFlags(args []string) (ScanOption, error) {
+	scanFlagSet := flag.NewFlagSet("scan", flag.ContinueOnError)
+	user := scanFlagSet.String("user", "", "specify the user to scan Java processes for")
+	all := scanFlagSet.Bool("all", false, "scan the Java processes of every user with an hsperfdata directory")
+	jsonOutput := scanFlagSet.Bool("json", false, "print the scan result as a JSON array")
+	timeout := scanFlagSet.Duration("timeout-per-process", defaultScanTimeout, "specify the time limit for inspecting each Java process")
+	concurrency := scanFlagSet.Int("concurrency", defaultConcurrency, "specify how many Java processes are inspected at once")
+	if err := scanFlagSet.Parse(args); err != nil {
+		return ScanOption{}, err
+	}
+	return ScanOption{
+		User:        *user,
+		All:         *all,
+		Json:        *jsonOutput,
+		Timeout:     *timeout,
+		Concurrency: *concurrency,
+	}, nil
+}
+
+// ScanValidate validates the ScanOption fields, defaulting User to the current user unless -all is given.
+func (opt *ScanOption) ScanValidate() error {
+	if opt.Timeout <= 0 {
+		return errors.New("timeout-per-process must be positive")
+	}
+	if opt.All {
+		if opt.User != "" {
+			return errors.New("user and all are mutually exclusive")
+		}
+		return nil
+	}
+	username, err := resolveUser(opt.User)
+	if err != nil {
+		return err
+	}
+	opt.User = username
+	return nil
+}
+
+// Attachability values of ScanEntry.Attachable. A JVM that could not be inspected in time is "unknown".
+const (
+	attachableYes     = "yes"
+	attachableNo      = "no"
+	attachableUnknown = "unknown"
+)
+
+// ScanEntry is what scan reports about one JVM. Error is set when the JVM could not be
+// fully inspected, e.g. because it exited or did not answer within the timeout.
+type ScanEntry struct {
+	Pid           int32  `json:"pid"`
+	User          string `json:"user"`
+	MainClass     string `json:"mainClass,omitempty"`
+	JVMVersion    string `json:"jvmVersion,omitempty"`
+	Attachable    string `json:"attachable"`
+	UptimeSeconds int64  `json:"uptimeSeconds,omitempty"`
+	Error         string `json:"error,omitempty"`
+	// Ambiguous is set when the pid was found under several users' hsperfdata directories,
+	// e.g. because a container's PID namespace reuses host pids.
+	Ambiguous bool `json:"ambiguous,omitempty"`
+}
+
+// scanTarget is a discovered JVM waiting to be inspected.
+type scanTarget struct {
+	pid      int32
+	username string
+}
+
+// Scan prints the pid, owner, main class, JVM version, attachability and uptime of every
+// discovered JVM. All JVMs are inspected in one parallel pass, each within option.Timeout,
+// so the total runtime stays bounded by the number of JVMs divided by option.Concurrency.
+func Scan(option ScanOption) int {
+	o := newOutput(option.Out, option.ErrOut)
+	if err := option.ScanValidate(); err != nil {
+		o.printError(err)
+		return 1
+	}
+
+	users := []string{option.User}
+	if option.All {
+		var err error
+		if users, err = hsperfdataUsers(); err != nil {
+			o.printError(err)
+			return 1
+		}
+	}
+	targets := []scanTarget{}
+	for _, u := range users {
+		pids, err := DiscoverJavaProcesses(u)
+		if err != nil {
+			continue
+		}
+		for _, pid := range pids {
+			targets = append(targets, scanTarget{pid: pid, username: u})
+		}
+	}
+	if len(targets) == 0 {
+		o.printError(errors.New("no java process"))
+		return 1
+	}
+
+	entries := scanTargets(targets, option.Timeout, option.Concurrency)
+	markAmbiguousPids(entries)
+	if option.Json {
+		data, err := json.Marshal(entries)
+		if err != nil {
+			o.printError(err)
+			return 1
+		}
+		o.print(string(data))
+		return 0
+	}
+	printScanTable(o, entries)
+	return 0
+}
+
+// scanTargets inspects targets in parallel, at most concurrency at a time. The result keeps
+// the order of targets; a JVM not inspected within timeout is reported with an error.
+// A timed out inspection cannot be interrupted, so it keeps its slot until it returns. If no slot
+// frees up within timeout, every worker is stuck and the remaining targets are reported as timed out.
+func scanTargets(targets []scanTarget, timeout time.Duration, concurrency int) []ScanEntry {
+	entries := make([]ScanEntry, len(targets))
+	sem := make(chan struct{}, concurrencyOrDefault(concurrency))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		select {
+		case sem <- struct{}{}:
+		case <-time.After(timeout):
+			for j := i; j < len(targets); j++ {
+				entries[j] = scanTimedOut(targets[j])
+			}
+			wg.Wait()
+			return entries
+		}
+		done := make(chan ScanEntry, 1)
+		go func(target scanTarget) {
+			defer func() { <-sem }()
+			done <- scanProcess(target)
+		}(target)
+		wg.Add(1)
+		go func(i int, target scanTarget) {
+			defer wg.Done()
+			select {
+			case entry := <-done:
+				entries[i] = entry
+			case <-time.After(timeout):
+				entries[i] = scanTimedOut(target)
+			}
+		}(i, target)
+	}
+	wg.Wait()
+	return entries
+}
+
+// scanTimedOut returns the entry of a target that was not inspected in time.
+func scanTimedOut(target scanTarget) ScanEntry {
+	return ScanEntry{Pid: target.pid, User: target.username, Attachable: attachableUnknown, Error: "timed out"}
+}
+
+// scanProcess inspects a single JVM through its command line and hsperfdata file.
+func scanProcess(target scanTarget) ScanEntry {
+	entry := ScanEntry{Pid: target.pid, User: target.username, Attachable: attachableUnknown}
+	cmdSlice, err := ProcessProvider(target.pid)
+	if err != nil {
+		entry.Error = err.Error()
+		return entry
+	}
+	entry.MainClass, _, _ = analyzeVmCmd(cmdSlice, JpsOption{})
+
+	jp := &JvmProcess{Pid: target.pid}
+	entry.Attachable = attachableNo
+	if !attachDisabled(cmdSlice) && (pkg.PathExists(jp.socketPath()) || canSignal(target.pid)) {
+		entry.Attachable = attachableYes
+	}
+
+	var startMillis int64
+	perfData, err := pkg.ReadPerfData(GetHsperfdataPath(target.username, fmt.Sprint(target.pid)))
+	if err == nil {
+		if entry.JVMVersion, _ = perfData.String("java.property.java.version"); entry.JVMVersion == "" {
+			entry.JVMVersion, _ = perfData.String("java.property.java.vm.version")
+		}
+		startMillis, _ = perfData.Long("sun.rt.createVmBeginTime")
+	}
+	if startMillis <= 0 {
+		if p, err := process.NewProcess(target.pid); err == nil {
+			startMillis, _ = p.CreateTime()
+		}
+	}
+	if startMillis > 0 {
+		entry.UptimeSeconds = int64(time.Since(time.UnixMilli(startMillis)).Seconds())
+	}
+	return entry
+}
+
+// markAmbiguousPids flags entries whose pid appears more than once, i.e. under several users.
+func markAmbiguousPids(entries []ScanEntry) {
+	pids := make([]int32, len(entries))
+	for i, e := range entries {
+		pids[i] = e.Pid
+	}
+	ambiguous := ambiguousPids(pids)
+	for i := range entries {
+		entries[i].Ambiguous = ambiguous[entries[i].Pid]
+	}
+}
+
+// ambiguousPids returns the pids that appear more than once in pids, i.e. under several users.
+func ambiguousPids(pids []int32) map[int32]bool {
+	counts := map[int32]int{}
+	for _, pid := range pids {
+		counts[pid]++
+	}
+	ambiguous := map[int32]bool{}
+	for pid, n := range counts {
+		if n > 1 {
+			ambiguous[pid] = true
+		}
+	}
+	return ambiguous
+}
+
+// warnAmbiguousPids warns about each pid that appears under several users, naming the users.
+// pids[i] is found under users[i].
+func warnAmbiguousPids(o *output, pids []int32, users []string) {
+	ambiguous := ambiguousPids(pids)
+	owners := map[int32][]string{}
+	var order []int32
+	for i, pid := range pids {
+		if !ambiguous[pid] {
+			continue
+		}
+		if len(owners[pid]) == 0 {
+			order = append(order, pid)
+		}
+		owners[pid] = append(owners[pid], users[i])
+	}
+	for _, pid := range order {
+		o.warn(fmt.Sprintf("pid %d is ambiguous, it appears under users %s (possibly different PID namespaces)", pid, strings.Join(owners[pid], ", ")))
+	}
+}
+
+// canSignal reports whether we may send signals to pid, which the attach handshake requires
+// when the JVM has not started its attach listener yet.
+func canSignal(pid int32) bool {
+	p, err := os.FindProcess(int(pid))
+	if err != nil {
+		return false
+	}
+	return p.Signal(syscall.Signal(0)) == nil
+}
+
+// printScanTable prints the entries as an aligned table with a header row.
+func printScanTable(o *output, entries []ScanEntry) {
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PID\tUSER\tMAIN CLASS\tVERSION\tATTACHABLE\tUPTIME")
+	for _, e := range entries {
+		uptime := "-"
+		if e.UptimeSeconds > 0 {
+			uptime = (time.Duration(e.UptimeSeconds) * time.Second).String()
+		}
+		attachable := e.Attachable
+		if e.Error != "" {
+			attachable += " (" + e.Error + ")"
+		}
+		user := e.User
+		if e.Ambiguous {
+			user += "*"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", e.Pid, user, orDash(e.MainClass), orDash(e.JVMVersion), attachable, uptime)
+	}
+	w.Flush()
+	for _, line := range strings.Split(strings.TrimRight(sb.String(), "\n"), "\n") {
+		o.print(strings.TrimRight(line, " "))
+	}
+
+	pids := make([]int32, len(entries))
+	users := make([]string, len(entries))
+	for i, e := range entries {
+		pids[i], users[i] = e.Pid, e.User
+	}
+	warnAmbiguousPids(o, pids, users)
+}
+
+// orDash returns s, or "-" if s is empty.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
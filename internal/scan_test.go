@@ -0,0 +1,160 @@
+package internal
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestScanValidate tests the -user/-all exclusivity and the timeout check.
+func TestScanValidate(t *testing.T) {
+	opt := ScanOption{User: "root", All: true, Timeout: time.Second}
+	if err := opt.ScanValidate(); err == nil {
+		t.Errorf("expected error for -user with -all")
+	}
+	opt = ScanOption{Timeout: 0}
+	if err := opt.ScanValidate(); err == nil {
+		t.Errorf("expected error for non-positive timeout")
+	}
+	opt = ScanOption{Timeout: time.Second}
+	if err := opt.ScanValidate(); err != nil || opt.User == "" {
+		t.Errorf("expected the current user, got %q, %v", opt.User, err)
+	}
+}
+
+// TestScanTargets_Timeout tests that a JVM hanging past the timeout is reported with an error
+// while the others are still inspected, in target order.
+func TestScanTargets_Timeout(t *testing.T) {
+	origProvider := ProcessProvider
+	release := make(chan struct{})
+	released := make(chan struct{})
+	defer func() {
+		// let the abandoned inspection finish before restoring the provider
+		close(release)
+		<-released
+		ProcessProvider = origProvider
+	}()
+	ProcessProvider = func(pid int32) ([]string, error) {
+		if pid == 2 {
+			<-release
+			defer close(released)
+		}
+		return []string{"java", "com.example.App"}, nil
+	}
+
+	start := time.Now()
+	entries := scanTargets([]scanTarget{{pid: 1, username: "alice"}, {pid: 2, username: "bob"}}, 50*time.Millisecond, 0)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected scan to be bounded by the timeout, took %v", elapsed)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].Pid != 1 || entries[0].MainClass != "com.example.App" || entries[0].Attachable == attachableUnknown || entries[0].Error != "" {
+		t.Errorf("unexpected entry for pid 1: %+v", entries[0])
+	}
+	if entries[1].Pid != 2 || entries[1].User != "bob" || entries[1].Attachable != attachableUnknown || entries[1].Error != "timed out" {
+		t.Errorf("expected a timeout for pid 2, got %+v", entries[1])
+	}
+}
+
+// TestPrintScanTable tests the table header and row rendering.
+func TestPrintScanTable(t *testing.T) {
+	var out bytes.Buffer
+
+	printScanTable(newOutput(&out, nil), []ScanEntry{
+		{Pid: 10, User: "alice", MainClass: "App", JVMVersion: "17.0.2", Attachable: attachableYes, UptimeSeconds: 90},
+		{Pid: 20, User: "bob", Attachable: attachableUnknown, Error: "timed out"},
+	})
+	logs := outputLines(&out)
+	if len(logs) != 3 {
+		t.Fatalf("expected header and 2 rows, got %v", logs)
+	}
+	if fields := strings.Fields(logs[1]); strings.Join(fields, " ") != "10 alice App 17.0.2 yes 1m30s" {
+		t.Errorf("unexpected row: %q", logs[1])
+	}
+	if !strings.Contains(logs[2], "unknown (timed out)") {
+		t.Errorf("expected the error in the row, got %q", logs[2])
+	}
+}
+
+// TestHsperfdataUsers tests that -all finds the owner of every hsperfdata directory.
+func TestHsperfdataUsers(t *testing.T) {
+	temp := t.TempDir()
+	t.Setenv("TMPDIR", temp)
+	for _, dir := range []string{"hsperfdata_bob", "hsperfdata_alice", "unrelated"} {
+		if err := os.Mkdir(temp+"/"+dir, 0755); err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+	}
+	users, err := hsperfdataUsers()
+	if err != nil || strings.Join(users, ",") != "alice,bob" {
+		t.Errorf("expected alice,bob, got %v, %v", users, err)
+	}
+}
+
+// TestScanAmbiguousPids tests that a pid found under several users is flagged and explained.
+func TestScanAmbiguousPids(t *testing.T) {
+	var out bytes.Buffer
+
+	entries := []ScanEntry{
+		{Pid: 10, User: "alice", Attachable: attachableYes},
+		{Pid: 10, User: "bob", Attachable: attachableNo},
+		{Pid: 20, User: "bob", Attachable: attachableYes},
+	}
+	markAmbiguousPids(entries)
+	if !entries[0].Ambiguous || !entries[1].Ambiguous || entries[2].Ambiguous {
+		t.Fatalf("expected only pid 10 to be ambiguous, got %+v", entries)
+	}
+
+	printScanTable(newOutput(&out, &out), entries)
+	logs := outputLines(&out)
+	if len(logs) != 5 {
+		t.Fatalf("expected header, 3 rows and a warning, got %v", logs)
+	}
+	if fields := strings.Fields(logs[1]); fields[1] != "alice*" {
+		t.Errorf("expected the owner to be marked, got %q", logs[1])
+	}
+	if logs[4] != "warning: pid 10 is ambiguous, it appears under users alice, bob (possibly different PID namespaces)" {
+		t.Errorf("unexpected warning: %q", logs[4])
+	}
+}
+
+// TestScanTargets_StuckWorkers tests that a timed out inspection keeps its concurrency slot, and
+// that targets left when every slot is stuck are reported as timed out instead of waiting forever.
+func TestScanTargets_StuckWorkers(t *testing.T) {
+	origProvider := ProcessProvider
+	release := make(chan struct{})
+	released := make(chan struct{})
+	defer func() {
+		close(release)
+		<-released
+		ProcessProvider = origProvider
+	}()
+	var calls atomic.Int32
+	ProcessProvider = func(pid int32) ([]string, error) {
+		calls.Add(1)
+		if pid == 1 {
+			<-release
+			defer close(released)
+		}
+		return []string{"java", "com.example.App"}, nil
+	}
+
+	start := time.Now()
+	entries := scanTargets([]scanTarget{{pid: 1}, {pid: 2}, {pid: 3}}, 50*time.Millisecond, 1)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected scan to be bounded by the timeout, took %v", elapsed)
+	}
+	for _, e := range entries {
+		if e.Error != "timed out" {
+			t.Errorf("expected pid %d to time out behind the stuck inspection, got %+v", e.Pid, e)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("expected only the stuck inspection to run with concurrency 1, got %d", n)
+	}
+}
@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"runtime"
+)
+
+// Build information, set at build time with
+// -ldflags "-X github.com/XHao/jvmtool/internal.Version=... -X ...Commit=... -X ...BuildTime=...".
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = "unknown"
+)
+
+type VersionOption struct {
+	Json   bool
+	Out    io.Writer // results, os.Stdout if nil
+	ErrOut io.Writer // errors, os.Stderr if nil
+}
+
+// VersionInfo describes the jvmtool build.
+type VersionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"buildTime"`
+	GoVersion string `json:"goVersion"`
+}
+
+// ParseVersionFlags parses flags for the "version" command and returns the corresponding VersionOption.
+func ParseVersionFlags(args []string) (VersionOption, error) {
+	versionFlagSet := flag.NewFlagSet("version", flag.ContinueOnError)
+	jsonOutput := versionFlagSet.Bool("json", false, "print the version information as JSON")
+	if err := versionFlagSet.Parse(args); err != nil {
+		return VersionOption{}, err
+	}
+	return VersionOption{Json: *jsonOutput}, nil
+}
+
+// GetVersionInfo returns the build information of the running binary.
+func GetVersionInfo() VersionInfo {
+	return VersionInfo{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+}
+
+// PrintVersion prints the build information, as JSON if requested.
+func PrintVersion(option VersionOption) int {
+	o := newOutput(option.Out, option.ErrOut)
+	info := GetVersionInfo()
+	if option.Json {
+		data, err := json.Marshal(info)
+		if err != nil {
+			o.printError(err)
+			return 1
+		}
+		o.print(string(data))
+		return 0
+	}
+	o.print(fmt.Sprintf("jvmtool %s", info.Version))
+	o.print(fmt.Sprintf("commit: %s", info.Commit))
+	o.print(fmt.Sprintf("build time: %s", info.BuildTime))
+	o.print(fmt.Sprintf("go version: %s", info.GoVersion))
+	return 0
+}
@@ -0,0 +1,27 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"runtime"
+	"testing"
+)
+
+// TestPrintVersion_Json tests that the JSON version output is machine-parseable.
+func TestPrintVersion_Json(t *testing.T) {
+	var out bytes.Buffer
+	if code := PrintVersion(VersionOption{Json: true, Out: &out}); code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+	logs := outputLines(&out)
+	if len(logs) != 1 {
+		t.Fatalf("expected a single JSON line, got %v", logs)
+	}
+	var info VersionInfo
+	if err := json.Unmarshal([]byte(logs[0]), &info); err != nil {
+		t.Fatalf("failed to parse version JSON: %v", err)
+	}
+	if info.Version != Version || info.GoVersion != runtime.Version() {
+		t.Errorf("unexpected version info: %+v", info)
+	}
+}
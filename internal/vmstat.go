@@ -0,0 +1,183 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/XHao/jvmtool/pkg"
+)
+
+// defaultVmstatInterval is the time between two vmstat samples unless -interval is given.
+const defaultVmstatInterval = time.Second
+
+type VmstatOption struct {
+	User     string
+	Pid      string
+	Interval time.Duration // -interval
+	Count    int           // -count, 0 samples until interrupted
+	Format   string        // -format, "" for the table or prometheus
+	Out      io.Writer     // results, os.Stdout if nil
+	ErrOut   io.Writer     // errors, os.Stderr if nil
+}
+
+// ParseVmstatFlags parses flags for the "vmstat" command and returns the corresponding VmstatOption.
+func ParseVmstatFlags(args []string) (VmstatOption, error) {
+	vmstatFlagSet := flag.NewFlagSet("vmstat", flag.ContinueOnError)
+	user := vmstatFlagSet.String("user", "", "specify the user owning the Java process")
+	pid := vmstatFlagSet.String("pid", "", "specify the pid of the Java process to sample")
+	interval := vmstatFlagSet.Duration("interval", defaultVmstatInterval, "specify the time between two samples")
+	count := vmstatFlagSet.Int("count", 0, "specify the number of samples, 0 for until interrupted")
+	format := vmstatFlagSet.String("format", "", "print a single snapshot of the counters as Prometheus metrics with prometheus")
+	if err := vmstatFlagSet.Parse(args); err != nil {
+		return VmstatOption{}, err
+	}
+	return VmstatOption{
+		User:     *user,
+		Pid:      *pid,
+		Interval: *interval,
+		Count:    *count,
+		Format:   *format,
+	}, nil
+}
+
+// VmstatValidate validates the VmstatOption fields. The JVM is not attached to, so only its
+// hsperfdata file has to be readable; a JVM with the attach mechanism disabled is fine.
+func (opt *VmstatOption) VmstatValidate() error {
+	if opt.Interval <= 0 {
+		return errors.New("interval must be positive")
+	}
+	if opt.Count < 0 {
+		return errors.New("count must not be negative")
+	}
+	if opt.Format != "" && opt.Format != formatPrometheus {
+		return fmt.Errorf("unsupported format %q, only %q is supported", opt.Format, formatPrometheus)
+	}
+	username, err := resolveUser(opt.User)
+	if err != nil {
+		return err
+	}
+	if opt.Pid == "" {
+		return ErrPidRequired
+	}
+	if !pkg.PathExists(GetHsperfdataPath(username, opt.Pid)) {
+		return ErrPidNotOwned
+	}
+	opt.User = username
+	return nil
+}
+
+// vmstatCounters are the live counters of one vmstat sample.
+type vmstatCounters struct {
+	heapUsed     int64 // bytes used in all heap spaces
+	heapCapacity int64 // bytes committed to all heap generations
+	threads      int64
+	classes      int64 // live loaded classes
+	gcs          int64 // collections by all collectors
+}
+
+// readVmstatCounters sums the counters of a perfdata snapshot as jstat does. Missing counters,
+// e.g. of a collector that does not export them, count as zero.
+// @see jdk/src/jdk.jcmd/share/classes/sun/tools/jstat/resources/jstat_options
+func readVmstatCounters(perfData *pkg.PerfData) vmstatCounters {
+	var c vmstatCounters
+	for name, counter := range perfData.Counters {
+		if counter.IsString {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(name, "sun.gc.generation.") && strings.Contains(name, ".space.") && strings.HasSuffix(name, ".used"):
+			c.heapUsed += counter.Long
+		case strings.HasPrefix(name, "sun.gc.generation.") && strings.Count(name, ".") == 4 && strings.HasSuffix(name, ".capacity"):
+			c.heapCapacity += counter.Long
+		case strings.HasPrefix(name, "sun.gc.collector.") && strings.HasSuffix(name, ".invocations"):
+			c.gcs += counter.Long
+		}
+	}
+	c.threads, _ = perfData.Long("java.threads.live")
+	c.classes, _ = liveClasses(perfData)
+	return c
+}
+
+// vmstatHeader names the columns of formatVmstatLine; "+" columns are the change since the previous sample.
+const vmstatHeader = "  HEAP_USED_K     +HEAP_K   HEAP_CAP_K  THREADS  CLASSES  +CLASSES       GC   +GC"
+
+// formatVmstatLine formats a sample, with the deltas to prev or zero deltas for the first sample.
+func formatVmstatLine(prev *vmstatCounters, cur vmstatCounters) string {
+	base := cur
+	if prev != nil {
+		base = *prev
+	}
+	return fmt.Sprintf("%13d %+11d %12d %8d %8d %+9d %8d %+5d",
+		cur.heapUsed>>10, (cur.heapUsed-base.heapUsed)>>10, cur.heapCapacity>>10,
+		cur.threads, cur.classes, cur.classes-base.classes, cur.gcs, cur.gcs-base.gcs)
+}
+
+// vmstatReader reads the perfdata snapshot of a JVM. It is a variable so that tests can replace it.
+var vmstatReader = pkg.ReadPerfData
+
+// Vmstat prints one line of live counters read from the hsperfdata file of the JVM every interval,
+// Count times or until interrupted. It stops early, successfully, once the JVM exits.
+func Vmstat(option VmstatOption) int {
+	o := newOutput(option.Out, option.ErrOut)
+	if err := option.VmstatValidate(); err != nil {
+		o.printError(err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return vmstat(ctx, option)
+}
+
+// vmstat samples until option.Count samples are printed or ctx is done. With -format prometheus
+// a single snapshot is printed, as a scraper runs it once per scrape.
+func vmstat(ctx context.Context, option VmstatOption) int {
+	o := newOutput(option.Out, option.ErrOut)
+	path := GetHsperfdataPath(option.User, option.Pid)
+	if option.Format == formatPrometheus {
+		perfData, err := vmstatReader(path)
+		if err != nil {
+			o.printError(err)
+			return 1
+		}
+		for _, line := range prometheusMetrics(option.Pid, perfData) {
+			o.print(line)
+		}
+		return 0
+	}
+	var prev *vmstatCounters
+	ticker := time.NewTicker(option.Interval)
+	defer ticker.Stop()
+	for i := 0; option.Count == 0 || i < option.Count; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return 0
+			case <-ticker.C:
+			}
+		}
+		perfData, err := vmstatReader(path)
+		if err != nil {
+			if prev != nil && os.IsNotExist(err) {
+				o.print(fmt.Sprintf("process %s exited", option.Pid))
+				return 0
+			}
+			o.printError(err)
+			return 1
+		}
+		if i == 0 {
+			o.print(vmstatHeader)
+		}
+		cur := readVmstatCounters(perfData)
+		o.print(formatVmstatLine(prev, cur))
+		prev = &cur
+	}
+	return 0
+}
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/XHao/jvmtool/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+// perfDataOf builds a snapshot with the given long counters.
+func perfDataOf(longs map[string]int64) *pkg.PerfData {
+	perfData := &pkg.PerfData{Counters: map[string]pkg.PerfCounter{}}
+	for name, value := range longs {
+		perfData.Counters[name] = pkg.PerfCounter{Name: name, Long: value}
+	}
+	return perfData
+}
+
+func TestReadVmstatCounters(t *testing.T) {
+	counters := readVmstatCounters(perfDataOf(map[string]int64{
+		"sun.gc.generation.0.capacity":         8 << 20,
+		"sun.gc.generation.0.space.0.used":     3 << 20,
+		"sun.gc.generation.0.space.0.capacity": 6 << 20,
+		"sun.gc.generation.0.space.1.used":     1 << 20,
+		"sun.gc.generation.1.capacity":         16 << 20,
+		"sun.gc.generation.1.space.0.used":     4 << 20,
+		"sun.gc.collector.0.invocations":       10,
+		"sun.gc.collector.1.invocations":       2,
+		"java.threads.live":                    25,
+		"java.cls.loadedClasses":               1000,
+		"java.cls.sharedLoadedClasses":         500,
+		"java.cls.unloadedClasses":             100,
+	}))
+	assert.Equal(t, vmstatCounters{heapUsed: 8 << 20, heapCapacity: 24 << 20, threads: 25, classes: 1400, gcs: 12}, counters)
+}
+
+func TestFormatVmstatLine(t *testing.T) {
+	first := vmstatCounters{heapUsed: 8 << 20, heapCapacity: 24 << 20, threads: 25, classes: 1500, gcs: 12}
+	second := vmstatCounters{heapUsed: 2 << 20, heapCapacity: 24 << 20, threads: 26, classes: 1510, gcs: 13}
+	assert.Equal(t, "         8192          +0        24576       25     1500        +0       12    +0", formatVmstatLine(nil, first))
+	assert.Equal(t, "         2048       -6144        24576       26     1510       +10       13    +1", formatVmstatLine(&first, second))
+	assert.Equal(t, len(vmstatHeader), len(formatVmstatLine(nil, first)))
+}
+
+func TestVmstat_Count(t *testing.T) {
+	var out bytes.Buffer
+	origReader := vmstatReader
+	defer func() { vmstatReader = origReader }()
+
+	reads := 0
+	vmstatReader = func(path string) (*pkg.PerfData, error) {
+		reads++
+		if reads > 2 {
+			return nil, os.ErrNotExist
+		}
+		return perfDataOf(map[string]int64{"sun.gc.collector.0.invocations": int64(reads)}), nil
+	}
+
+	option := VmstatOption{User: "alice", Pid: "12345", Interval: time.Millisecond, Count: 2, Out: &out, ErrOut: &out}
+	assert.Equal(t, 0, vmstat(context.Background(), option))
+	assert.Len(t, outputLines(&out), 3)
+
+	// the JVM exiting ends sampling before Count is reached
+	reads = 0
+	option.Count = 5
+	assert.Equal(t, 0, vmstat(context.Background(), option))
+	assert.Equal(t, "process 12345 exited", outputLines(&out)[len(outputLines(&out))-1])
+
+	// a JVM that cannot be read at all is an error
+	reads = 10
+	assert.Equal(t, 1, vmstat(context.Background(), option))
+}
@@ -3,6 +3,9 @@ package pkg
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
 )
 
@@ -47,3 +50,34 @@ var PidExists = func(pid int32) (bool, error) {
 
 	return false, err
 }
+
+// ProcRoot is the mount point of procfs. It is a variable so that tests can replace it.
+var ProcRoot = "/proc"
+
+// NamespacedPid returns the pid of hostPid in the innermost pid namespace it belongs to, e.g. the
+// pid a containerized JVM knows itself by, read from the NSpid line of /proc/<hostPid>/status.
+// hostPid is returned unchanged if the process is not in a nested pid namespace.
+func NamespacedPid(hostPid int32) (int32, error) {
+	data, err := os.ReadFile(filepath.Join(ProcRoot, strconv.Itoa(int(hostPid)), "status"))
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		value, ok := strings.CutPrefix(line, "NSpid:")
+		if !ok {
+			continue
+		}
+		// one pid per nesting level, from the namespace of ProcRoot inwards
+		pids := strings.Fields(value)
+		if len(pids) == 0 {
+			return 0, fmt.Errorf("empty NSpid for pid %d", hostPid)
+		}
+		pid, err := strconv.ParseInt(pids[len(pids)-1], 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("malformed NSpid for pid %d: %q", hostPid, strings.TrimSpace(value))
+		}
+		return int32(pid), nil
+	}
+	// kernels before 4.1 have no NSpid line and no way to tell
+	return hostPid, nil
+}
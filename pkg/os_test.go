@@ -2,6 +2,8 @@ package pkg
 
 import (
 	"os"
+	"path/filepath"
+	"strconv"
 	"syscall"
 	"testing"
 )
@@ -63,3 +65,51 @@ func TestPidExists(t *testing.T) {
 		t.Errorf("PidExists(%d) should return false for non-existent pid", nonExistPid)
 	}
 }
+
+// TestNamespacedPid tests resolving the innermost pid from synthetic status files under a fake proc root.
+func TestNamespacedPid(t *testing.T) {
+	origProcRoot := ProcRoot
+	defer func() { ProcRoot = origProcRoot }()
+	ProcRoot = t.TempDir()
+
+	tests := []struct {
+		name     string
+		status   string // "" for no status file
+		expected int32
+		err      bool
+	}{
+		{name: "single namespace", status: "Name:\tjava\nPid:\t200\nNSpid:\t200\n", expected: 200},
+		{name: "container", status: "Name:\tjava\nPid:\t300\nNSpid:\t300\t1\n", expected: 1},
+		{name: "nested namespaces", status: "Name:\tjava\nPid:\t400\nNSpid:\t400\t7\t1\n", expected: 1},
+		{name: "extra whitespace", status: "NSpid:  500   42  \nNStgid:\t500\t42\n", expected: 42},
+		{name: "no NSpid line", status: "Name:\tjava\nPid:\t600\n", expected: 600},
+		{name: "empty NSpid", status: "NSpid:\t\n", err: true},
+		{name: "non-numeric NSpid", status: "NSpid:\t800\tx\n", err: true},
+		{name: "out of range NSpid", status: "NSpid:\t900\t99999999999\n", err: true},
+		{name: "missing process", err: true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hostPid := int32(100 * (i + 2))
+			if tt.status != "" {
+				dir := filepath.Join(ProcRoot, strconv.Itoa(int(hostPid)))
+				if err := os.MkdirAll(dir, 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(dir, "status"), []byte(tt.status), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			pid, err := NamespacedPid(hostPid)
+			if tt.err {
+				if err == nil {
+					t.Errorf("expected an error, got pid %d", pid)
+				}
+				return
+			}
+			if err != nil || pid != tt.expected {
+				t.Errorf("NamespacedPid(%d) = %d, %v, expected %d", hostPid, pid, err, tt.expected)
+			}
+		})
+	}
+}
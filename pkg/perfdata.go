@@ -0,0 +1,190 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// PerfDataMagic is the magic number at the start of every hsperfdata file, always stored big-endian.
+const PerfDataMagic = 0xcafec0c0
+
+const (
+	perfDataPrologueSize   = 32
+	perfDataEntryHeaderLen = 20
+	perfDataMaxRetries     = 5
+	perfDataRetryInterval  = 10 * time.Millisecond
+)
+
+// ErrNotPerfData is returned when a file does not start with the hsperfdata magic number.
+var ErrNotPerfData = errors.New("not an hsperfdata file")
+
+// ErrPerfDataInconsistent is returned when the prologue and entries disagree, e.g. while the JVM is updating them.
+var ErrPerfDataInconsistent = errors.New("inconsistent hsperfdata snapshot")
+
+// PerfCounter is a single counter of an hsperfdata file.
+// Numeric counters set Long; byte-vector counters are exposed as String.
+type PerfCounter struct {
+	Name        string
+	Units       byte
+	Variability byte
+	IsString    bool
+	Long        int64
+	String      string
+}
+
+// PerfData is a best-effort snapshot of the counters exported by a JVM through its hsperfdata file.
+// The JVM updates counters in place without locking, so values may be slightly stale or mixed
+// between two updates; only the structure of the snapshot is validated.
+type PerfData struct {
+	ModTimeStamp int64
+	Counters     map[string]PerfCounter
+}
+
+// Long returns the value of a numeric counter.
+func (p *PerfData) Long(name string) (int64, bool) {
+	c, ok := p.Counters[name]
+	if !ok || c.IsString {
+		return 0, false
+	}
+	return c.Long, true
+}
+
+// String returns the value of a string counter.
+func (p *PerfData) String(name string) (string, bool) {
+	c, ok := p.Counters[name]
+	if !ok || !c.IsString {
+		return "", false
+	}
+	return c.String, true
+}
+
+// MaybePerfData reports whether the file at path could be an hsperfdata file. Only a file
+// starting with a word that is neither the magic number nor zero, as left by a JVM that has
+// not finished initializing it, is rejected; unreadable and short files get the benefit of the doubt.
+func MaybePerfData(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return true
+	}
+	defer f.Close()
+	var header [4]byte
+	if _, err := io.ReadFull(f, header[:]); err != nil {
+		return true
+	}
+	magic := binary.BigEndian.Uint32(header[:])
+	return magic == PerfDataMagic || magic == 0
+}
+
+// ReadPerfData reads the hsperfdata file at path in a single read and parses it.
+// If the snapshot looks torn or not yet initialized, as when the JVM is mid-update or just started,
+// it is re-read a bounded number of times.
+func ReadPerfData(path string) (*PerfData, error) {
+	var err error
+	for i := 0; i < perfDataMaxRetries; i++ {
+		var data []byte
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var perfData *PerfData
+		perfData, err = ParsePerfData(data)
+		if !errors.Is(err, ErrPerfDataInconsistent) {
+			return perfData, err
+		}
+		time.Sleep(perfDataRetryInterval)
+	}
+	return nil, err
+}
+
+// ParsePerfData parses an in-memory hsperfdata snapshot (format version 2).
+// @see jdk/src/hotspot/share/runtime/perfMemory.hpp
+func ParsePerfData(data []byte) (*PerfData, error) {
+	if len(data) >= 4 {
+		// the JVM creates the file zero-filled and writes the prologue afterwards
+		if magic := binary.BigEndian.Uint32(data); magic == 0 {
+			return nil, fmt.Errorf("%w: magic not yet written", ErrPerfDataInconsistent)
+		} else if magic != PerfDataMagic {
+			return nil, ErrNotPerfData
+		}
+	}
+	if len(data) < perfDataPrologueSize {
+		return nil, fmt.Errorf("%w: truncated prologue", ErrPerfDataInconsistent)
+	}
+	var order binary.ByteOrder = binary.BigEndian
+	if data[4] == 1 {
+		order = binary.LittleEndian
+	}
+	if major := data[5]; major != 2 {
+		return nil, fmt.Errorf("unsupported hsperfdata version %d.%d", major, data[6])
+	}
+	if accessible := data[7]; accessible == 0 {
+		return nil, fmt.Errorf("%w: not yet accessible", ErrPerfDataInconsistent)
+	}
+	used := int(order.Uint32(data[8:]))
+	modTimeStamp := int64(order.Uint64(data[16:]))
+	entryOffset := int(order.Uint32(data[24:]))
+	numEntries := int(order.Uint32(data[28:]))
+	if used > len(data) || entryOffset < perfDataPrologueSize || entryOffset > used {
+		return nil, fmt.Errorf("%w: used %d, entry offset %d, size %d", ErrPerfDataInconsistent, used, entryOffset, len(data))
+	}
+	// a running JVM always has counters, none means they are not created yet
+	if numEntries == 0 {
+		return nil, fmt.Errorf("%w: no entries yet", ErrPerfDataInconsistent)
+	}
+
+	perfData := &PerfData{ModTimeStamp: modTimeStamp, Counters: make(map[string]PerfCounter, numEntries)}
+	offset := entryOffset
+	for i := 0; i < numEntries; i++ {
+		if offset+perfDataEntryHeaderLen > used {
+			return nil, fmt.Errorf("%w: entry %d out of bounds", ErrPerfDataInconsistent, i)
+		}
+		entry := data[offset:]
+		entryLength := int(order.Uint32(entry))
+		nameOffset := int(order.Uint32(entry[4:]))
+		vectorLength := int(order.Uint32(entry[8:]))
+		dataType := entry[12]
+		dataUnits := entry[14]
+		dataVariability := entry[15]
+		dataOffset := int(order.Uint32(entry[16:]))
+		if entryLength < perfDataEntryHeaderLen || offset+entryLength > used ||
+			nameOffset >= entryLength || dataOffset >= entryLength {
+			return nil, fmt.Errorf("%w: entry %d malformed", ErrPerfDataInconsistent, i)
+		}
+		entry = entry[:entryLength]
+
+		name := entry[nameOffset:]
+		if end := bytes.IndexByte(name, 0); end >= 0 {
+			name = name[:end]
+		}
+		counter := PerfCounter{Name: string(name), Units: dataUnits, Variability: dataVariability}
+		value := entry[dataOffset:]
+		switch {
+		case vectorLength == 0 && dataType == 'J':
+			if len(value) < 8 {
+				return nil, fmt.Errorf("%w: entry %d truncated", ErrPerfDataInconsistent, i)
+			}
+			counter.Long = int64(order.Uint64(value))
+		case vectorLength > 0 && dataType == 'B':
+			if vectorLength < len(value) {
+				value = value[:vectorLength]
+			}
+			if end := bytes.IndexByte(value, 0); end >= 0 {
+				value = value[:end]
+			}
+			counter.IsString = true
+			counter.String = string(value)
+		default:
+			// other types are not produced by HotSpot; skip them
+			offset += entryLength
+			continue
+		}
+		perfData.Counters[counter.Name] = counter
+		offset += entryLength
+	}
+	return perfData, nil
+}
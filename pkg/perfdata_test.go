@@ -0,0 +1,184 @@
+package pkg
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// buildPerfData encodes a little-endian hsperfdata v2 snapshot with the given long and string counters.
+func buildPerfData(longs map[string]int64, strings map[string]string) []byte {
+	var entries []byte
+	add := func(name string, dataType byte, vectorLength int, value []byte) {
+		nameBytes := append([]byte(name), 0)
+		dataOffset := perfDataEntryHeaderLen + len(nameBytes)
+		entryLength := dataOffset + len(value)
+		entry := make([]byte, perfDataEntryHeaderLen)
+		binary.LittleEndian.PutUint32(entry, uint32(entryLength))
+		binary.LittleEndian.PutUint32(entry[4:], perfDataEntryHeaderLen)
+		binary.LittleEndian.PutUint32(entry[8:], uint32(vectorLength))
+		entry[12] = dataType
+		entry[14] = 4
+		entry[15] = 3
+		binary.LittleEndian.PutUint32(entry[16:], uint32(dataOffset))
+		entry = append(entry, nameBytes...)
+		entries = append(entries, append(entry, value...)...)
+	}
+	for name, v := range longs {
+		value := make([]byte, 8)
+		binary.LittleEndian.PutUint64(value, uint64(v))
+		add(name, 'J', 0, value)
+	}
+	for name, v := range strings {
+		value := append([]byte(v), 0)
+		add(name, 'B', len(value), value)
+	}
+
+	prologue := make([]byte, perfDataPrologueSize)
+	binary.BigEndian.PutUint32(prologue, PerfDataMagic)
+	prologue[4] = 1
+	prologue[5] = 2
+	prologue[7] = 1
+	binary.LittleEndian.PutUint32(prologue[8:], uint32(perfDataPrologueSize+len(entries)))
+	binary.LittleEndian.PutUint64(prologue[16:], 42)
+	binary.LittleEndian.PutUint32(prologue[24:], perfDataPrologueSize)
+	binary.LittleEndian.PutUint32(prologue[28:], uint32(len(longs)+len(strings)))
+	return append(prologue, entries...)
+}
+
+// TestParsePerfData tests parsing long and string counters from a snapshot.
+func TestParsePerfData(t *testing.T) {
+	data := buildPerfData(
+		map[string]int64{"java.cls.loadedClasses": 1234},
+		map[string]string{"sun.rt.javaCommand": "com.example.App arg1"},
+	)
+	perfData, err := ParsePerfData(data)
+	if err != nil {
+		t.Fatalf("ParsePerfData failed: %v", err)
+	}
+	if perfData.ModTimeStamp != 42 {
+		t.Errorf("expected mod timestamp 42, got %d", perfData.ModTimeStamp)
+	}
+	if v, ok := perfData.Long("java.cls.loadedClasses"); !ok || v != 1234 {
+		t.Errorf("expected 1234, got %d, %v", v, ok)
+	}
+	if v, ok := perfData.String("sun.rt.javaCommand"); !ok || v != "com.example.App arg1" {
+		t.Errorf("expected javaCommand, got %q, %v", v, ok)
+	}
+	if _, ok := perfData.Long("sun.rt.javaCommand"); ok {
+		t.Errorf("expected string counter not to be returned as long")
+	}
+}
+
+// TestParsePerfData_Invalid tests that non-perfdata and truncated snapshots are rejected.
+func TestParsePerfData_Invalid(t *testing.T) {
+	if _, err := ParsePerfData([]byte("not perfdata")); !errors.Is(err, ErrNotPerfData) {
+		t.Errorf("expected ErrNotPerfData, got: %v", err)
+	}
+	data := buildPerfData(map[string]int64{"a": 1, "b": 2}, nil)
+	if _, err := ParsePerfData(data[:len(data)-10]); !errors.Is(err, ErrPerfDataInconsistent) {
+		t.Errorf("expected ErrPerfDataInconsistent, got: %v", err)
+	}
+	// a file the JVM has created but not initialized yet is retried, not rejected
+	if _, err := ParsePerfData(make([]byte, len(data))); !errors.Is(err, ErrPerfDataInconsistent) {
+		t.Errorf("expected ErrPerfDataInconsistent for a zero magic, got: %v", err)
+	}
+	if _, err := ParsePerfData(buildPerfData(nil, nil)); !errors.Is(err, ErrPerfDataInconsistent) {
+		t.Errorf("expected ErrPerfDataInconsistent for no entries, got: %v", err)
+	}
+}
+
+// TestReadPerfData_Initializing tests that a file still being initialized is re-read until it is complete.
+func TestReadPerfData_Initializing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "12345")
+	data := buildPerfData(map[string]int64{"sun.gc.collector.0.invocations": 1}, nil)
+	if err := os.WriteFile(path, make([]byte, len(data)), 0644); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+	go func() {
+		time.Sleep(perfDataRetryInterval)
+		os.WriteFile(path, data, 0644)
+	}()
+
+	perfData, err := ReadPerfData(path)
+	if err != nil {
+		t.Fatalf("expected the initialized file to be read, got: %v", err)
+	}
+	if v, _ := perfData.Long("sun.gc.collector.0.invocations"); v != 1 {
+		t.Errorf("expected 1, got %d", v)
+	}
+}
+
+// TestReadPerfData_ConcurrentWriter reads a fixture while a writer keeps rewriting it,
+// asserting that every successful read is a complete snapshot.
+func TestReadPerfData_ConcurrentWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "12345")
+	snapshots := [][]byte{
+		buildPerfData(map[string]int64{"sun.gc.collector.0.invocations": 1}, map[string]string{"sun.rt.javaCommand": "App"}),
+		buildPerfData(map[string]int64{"sun.gc.collector.0.invocations": 2}, map[string]string{"sun.rt.javaCommand": "App"}),
+	}
+	if err := os.WriteFile(path, snapshots[0], 0644); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			os.WriteFile(path, snapshots[i%2], 0644)
+		}
+	}()
+
+	for i := 0; i < 200; i++ {
+		perfData, err := ReadPerfData(path)
+		if err != nil {
+			if !errors.Is(err, ErrPerfDataInconsistent) && !errors.Is(err, ErrNotPerfData) {
+				t.Errorf("unexpected error: %v", err)
+			}
+			continue
+		}
+		v, ok := perfData.Long("sun.gc.collector.0.invocations")
+		if !ok || (v != 1 && v != 2) {
+			t.Errorf("expected a complete snapshot, got %d, %v", v, ok)
+		}
+		if cmd, _ := perfData.String("sun.rt.javaCommand"); cmd != "App" {
+			t.Errorf("expected javaCommand App, got %q", cmd)
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+// TestMaybePerfData tests the magic check, tolerating files still being initialized.
+func TestMaybePerfData(t *testing.T) {
+	dir := t.TempDir()
+	cases := map[string]struct {
+		data     []byte
+		expected bool
+	}{
+		"perfdata": {buildPerfData(nil, nil), true},
+		"zeroed":   {make([]byte, 64), true},
+		"empty":    {nil, true},
+		"text":     {[]byte("12345 not perfdata"), false},
+	}
+	for name, c := range cases {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, c.data, 0644); err != nil {
+			t.Fatalf("failed to write fixture: %v", err)
+		}
+		if got := MaybePerfData(path); got != c.expected {
+			t.Errorf("%s: expected %v, got %v", name, c.expected, got)
+		}
+	}
+}